@@ -28,6 +28,7 @@ package app
 
 import (
 	"fmt"
+	"github.com/mdhender/bel/bel"
 	"github.com/mdhender/bel/router"
 	"log"
 	"net/http"
@@ -38,17 +39,45 @@ import (
 // That just means that it has an http server embedded in it.
 type Server struct {
 	http.Server
+
+	// limits for each request to evaluate Bel source. EvalMaxOutput
+	// bounds the bytes captured from each of stdout and stderr.
+	EvalLimits    bel.Limits
+	EvalTimeout   time.Duration
+	EvalMaxBytes  int64
+	EvalMaxOutput int
+
+	// sessions keep a VM between requests. A session that is idle for
+	// longer than SessionIdle is closed. No more than MaxSessions may
+	// be open at once. A session that keeps more than SessionCells
+	// pairs beyond those of a new VM is closed.
+	SessionIdle  time.Duration
+	MaxSessions  int
+	SessionCells int
+	sessions     sessionTable
+
+	// now returns the current time. Tests replace it to expire
+	// sessions without waiting.
+	now func() time.Time
 }
 
 // NewApp returns a default application server
 func NewServer(port int) *Server {
 	a := &Server{
-		http.Server{
+		Server: http.Server{
 			Addr:           fmt.Sprintf(":%d", port),
 			MaxHeaderBytes: 1 << 20,
 			ReadTimeout:    5 * time.Second,
 			WriteTimeout:   5 * time.Second,
 		},
+		EvalLimits:    bel.Limits{Steps: 1000000, Cells: 1000000, Depth: 10000},
+		EvalTimeout:   2 * time.Second,
+		EvalMaxBytes:  1 << 20,
+		EvalMaxOutput: 1 << 20,
+		SessionIdle:   10 * time.Minute,
+		MaxSessions:   100,
+		SessionCells:  1000000,
+		now:           time.Now,
 	}
 	a.Handler = a
 	return a
@@ -100,6 +129,12 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "about":
 		srv.handleAbout(w, r)
 		return
+	case "eval":
+		srv.handleEval(w, r)
+		return
+	case "sessions":
+		srv.handleSessions(w, r)
+		return
 	default:
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
@@ -0,0 +1,186 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/mdhender/bel/bel"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// evalResult is the response for a request to evaluate Bel source
+type evalResult struct {
+	Values []string   `json:"values"`
+	Stdout string     `json:"stdout"`
+	Stderr string     `json:"stderr"`
+	Error  *evalError `json:"error,omitempty"`
+}
+
+// evalError describes an error that stopped an evaluation.
+// Kind is "bel" for an error signalled by the program, "limit" for
+// a limit that it exceeded, "timeout" if it ran out of time, and
+// "internal" if the interpreter panicked.
+type evalError struct {
+	Kind      string        `json:"kind"`
+	Message   string        `json:"message"`
+	Value     string        `json:"value,omitempty"`
+	Irritants []string      `json:"irritants,omitempty"`
+	Position  *evalPosition `json:"position,omitempty"`
+}
+
+// evalPosition is the position of the expression that signalled an error
+type evalPosition struct {
+	Name string `json:"name"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
+}
+
+// errOutputLimit is the error from writing more output than an
+// evaluation may. Bel programs see it as the error output-limit.
+var errOutputLimit = errors.New("output-limit")
+
+// outputBuffer captures the output of an evaluation, up to max bytes.
+// A write that doesn't fit stores what does and fails.
+type outputBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+// newOutputBuffer returns a buffer for the output of an evaluation
+func (srv *Server) newOutputBuffer() *outputBuffer {
+	return &outputBuffer{max: srv.EvalMaxOutput}
+}
+
+// Write implements the io.Writer interface
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); b.max > 0 && len(p) > room {
+		n, _ := b.Buffer.Write(p[:room])
+		return n, errOutputLimit
+	}
+	return b.Buffer.Write(p)
+}
+
+// newVM returns a sandboxed VM for evaluating the source in a request.
+// It can't read files or the console, and its output is captured.
+func (srv *Server) newVM(stdout, stderr *outputBuffer) *bel.VM {
+	return bel.NewVM(nil,
+		bel.WithIO(strings.NewReader(""), stdout, stderr),
+		bel.WithoutFiles(),
+		bel.WithLimits(srv.EvalLimits))
+}
+
+// evalSource evaluates the source in vm and returns the result and
+// the status for the response. A panic in the interpreter is logged
+// and reported as an internal error rather than ending the process.
+func (srv *Server) evalSource(ctx context.Context, vm *bel.VM, src string, stdout, stderr *outputBuffer) (result evalResult, status int) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[app] eval: panic: %v\n%s", r, debug.Stack())
+			result = evalResult{Values: []string{}, Error: &evalError{Kind: "internal", Message: "internal error"}}
+			status = http.StatusInternalServerError
+		}
+	}()
+	if srv.EvalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, srv.EvalTimeout)
+		defer cancel()
+	}
+	values, err := vm.ExecuteContext(ctx, []byte(src))
+	result = evalResult{Values: []string{}}
+	for _, v := range values {
+		result.Values = append(result.Values, v.String())
+	}
+	result.Stdout, result.Stderr = stdout.String(), stderr.String()
+	if err == nil {
+		return result, http.StatusOK
+	}
+
+	result.Error = &evalError{Kind: "limit", Message: err.Error()}
+	var e *bel.Error
+	switch {
+	case errors.As(err, &e):
+		result.Error.Kind, result.Error.Value = "bel", e.Value.String()
+		irritants, _ := e.Irritants.Slice()
+		for _, a := range irritants {
+			result.Error.Irritants = append(result.Error.Irritants, a.String())
+		}
+		if p := e.Position; p.Name != "" {
+			result.Error.Position = &evalPosition{Name: p.Name, Line: p.Line, Col: p.Col}
+		}
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		result.Error.Kind = "timeout"
+	}
+	return result, http.StatusUnprocessableEntity
+}
+
+// readSource returns the Bel source from the body of a request,
+// which is either plain text or JSON like {"src": "(+ 1 2)"}.
+func (srv *Server) readSource(w http.ResponseWriter, r *http.Request) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, srv.EvalMaxBytes)
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/json" {
+		var body struct {
+			Src string `json:"src"`
+		}
+		if err := srv.decode(w, r, &body); err != nil {
+			return "", err
+		}
+		return body.Src, nil
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	return string(b), err
+}
+
+// Handler supports
+//
+//	POST /eval
+func (srv *Server) handleEval(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "POST":
+		src, err := srv.readSource(w, r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		stdout, stderr := srv.newOutputBuffer(), srv.newOutputBuffer()
+		result, status := srv.evalSource(r.Context(), srv.newVM(stdout, stderr), src, stdout, stderr)
+		log.Printf("[app] eval: %d bytes: status %d", len(src), status)
+		srv.respond(w, r, result, status)
+		return
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+}
@@ -0,0 +1,190 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package app
+
+import (
+	"encoding/json"
+	"github.com/mdhender/bel/bel"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// post sends a request to the server and decodes the result
+func post(t *testing.T, srv *Server, path, contentType, body string) (int, evalResult) {
+	t.Helper()
+	r := httptest.NewRequest("POST", path, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	var result evalResult
+	switch w.Code {
+	case http.StatusOK, http.StatusUnprocessableEntity, http.StatusInternalServerError:
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("%s: %s: %v", path, body, err)
+		}
+	}
+	return w.Code, result
+}
+
+func TestEval(t *testing.T) {
+	srv := NewServer(0)
+	for _, tc := range []struct {
+		contentType string
+		body        string
+		status      int
+		values      string
+		stdout      string
+		kind        string
+	}{
+		{"text/plain", `(+ 1 2) (cons 'a "b")`, http.StatusOK, `3 (a . "b")`, "", ""},
+		{"", `(pr "hi") (prn 'x)`, http.StatusOK, `"hi" x`, "hix \n", ""},
+		{"application/json", `{"src": "(map car '((a b) (c d)))"}`, http.StatusOK, `(a c)`, "", ""},
+		{"application/json; charset=utf-8", `{"src": "\"λ\""}`, http.StatusOK, `"λ"`, "", ""},
+		// a cyclic value is printed with labels rather than forever
+		{"text/plain", `'#1=(\a . #1)`, http.StatusOK, `#1=(\a . #1)`, "", ""},
+		{"text/plain", `(pr 1) (car 'a) (pr 2)`, http.StatusUnprocessableEntity, `1`, "1", "bel"},
+		{"text/plain", `(while t)`, http.StatusUnprocessableEntity, ``, "", "limit"},
+		{"text/plain", `(load "app.go")`, http.StatusUnprocessableEntity, ``, "", "bel"},
+	} {
+		status, result := post(t, srv, "/eval", tc.contentType, tc.body)
+		if status != tc.status {
+			t.Errorf("%s: status: expected %d: got %d", tc.body, tc.status, status)
+			continue
+		}
+		if got := strings.Join(result.Values, " "); got != tc.values {
+			t.Errorf("%s: values: expected %s: got %s", tc.body, tc.values, got)
+		}
+		if result.Stdout != tc.stdout {
+			t.Errorf("%s: stdout: expected %q: got %q", tc.body, tc.stdout, result.Stdout)
+		}
+		if tc.kind == "" && result.Error != nil {
+			t.Errorf("%s: expected no error: got %+v", tc.body, result.Error)
+		} else if tc.kind != "" && (result.Error == nil || result.Error.Kind != tc.kind) {
+			t.Errorf("%s: expected %s error: got %+v", tc.body, tc.kind, result.Error)
+		}
+	}
+
+	// errors signalled by the program include the value, irritants, and position
+	_, result := post(t, srv, "/eval", "text/plain", "1\n  (car 'a)")
+	if e := result.Error; e == nil || e.Value != "car-on-atom" || len(e.Irritants) != 1 || e.Irritants[0] != "(car a)" ||
+		e.Position == nil || *e.Position != (evalPosition{Name: "source.bel", Line: 2, Col: 3}) {
+		t.Errorf("bel error: got %+v", result.Error)
+	}
+
+	for _, tc := range []struct {
+		method, path, contentType, body string
+		status                          int
+	}{
+		{"GET", "/eval", "", "", http.StatusMethodNotAllowed},
+		{"POST", "/eval/x", "text/plain", "1", http.StatusNotFound},
+		{"POST", "/eval", "application/json", `{"src": `, http.StatusBadRequest},
+		{"POST", "/eval", "text/plain", strings.Repeat(" ", 1<<20+1), http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("%s %s: expected %d: got %d", tc.method, tc.path, tc.status, w.Code)
+		}
+	}
+}
+
+func TestEvalTimeout(t *testing.T) {
+	srv := NewServer(0)
+	srv.EvalLimits, srv.EvalTimeout = bel.Limits{}, 50*time.Millisecond
+	start := time.Now()
+	status, result := post(t, srv, "/eval", "text/plain", `(while t)`)
+	if status != http.StatusUnprocessableEntity || result.Error == nil || result.Error.Kind != "timeout" {
+		t.Errorf("timeout: expected 422 timeout: got %d %+v", status, result.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout: took %v", elapsed)
+	}
+}
+
+func TestEvalOutputLimit(t *testing.T) {
+	srv := NewServer(0)
+	srv.EvalMaxOutput = 10
+	status, result := post(t, srv, "/eval", "text/plain", `(pr "0123456") (pr "789abc")`)
+	if status != http.StatusUnprocessableEntity || result.Error == nil || result.Error.Value != "output-limit" {
+		t.Errorf("output limit: expected 422 output-limit: got %d %+v", status, result.Error)
+	}
+	if result.Stdout != "0123456789" {
+		t.Errorf("output limit: expected 0123456789: got %q", result.Stdout)
+	}
+	// a program that keeps printing is stopped by the other limits
+	status, result = post(t, srv, "/eval", "text/plain", `(while t (onerr nil (pr "x")))`)
+	if status != http.StatusUnprocessableEntity || len(result.Stdout) != 10 {
+		t.Errorf("output limit: expected 422 and 10 bytes: got %d %q", status, result.Stdout)
+	}
+}
+
+func TestEvalHostile(t *testing.T) {
+	// programs that used to crash the process or run without bound are
+	// stopped within the limits, and the server keeps serving
+	srv := NewServer(0)
+	srv.EvalTimeout = 500 * time.Millisecond
+	for _, tc := range []struct {
+		body   string
+		status int
+		values string
+		kind   string
+		value  string
+	}{
+		{`(let x (list 1) (xar x x) (json-write x))`, http.StatusUnprocessableEntity, ``, "bel", "cyclic"},
+		{`(with (x (list 1) y (list 1)) (xdr x x) (xdr y y) (= x y))`, http.StatusOK, `t`, "", ""},
+		{`(with (x (list 1) y (list 1)) (xar x x) (xar y y) (= x y))`, http.StatusOK, `t`, "", ""},
+		{`(let x 2 (while t (set x (* x x))))`, http.StatusUnprocessableEntity, ``, "limit", ""},
+		{`(car (1 2))`, http.StatusUnprocessableEntity, ``, "bel", "mistype"},
+		{`(let x (list 1) (xdr x x) (100000000000000000000 x))`, http.StatusUnprocessableEntity, ``, "timeout", ""},
+	} {
+		start := time.Now()
+		status, result := post(t, srv, "/eval", "text/plain", tc.body)
+		if elapsed := time.Since(start); elapsed > srv.EvalTimeout+time.Second {
+			t.Errorf("%s: took %v", tc.body, elapsed)
+		}
+		if status != tc.status {
+			t.Errorf("%s: status: expected %d: got %d", tc.body, tc.status, status)
+			continue
+		}
+		if got := strings.Join(result.Values, " "); got != tc.values {
+			t.Errorf("%s: values: expected %s: got %s", tc.body, tc.values, got)
+		}
+		if tc.kind == "" && result.Error != nil {
+			t.Errorf("%s: expected no error: got %+v", tc.body, result.Error)
+		} else if tc.kind != "" && (result.Error == nil || result.Error.Kind != tc.kind || result.Error.Value != tc.value) {
+			t.Errorf("%s: expected %s %s: got %+v", tc.body, tc.kind, tc.value, result.Error)
+		}
+	}
+	if status, result := post(t, srv, "/eval", "text/plain", `(+ 1 2)`); status != http.StatusOK || strings.Join(result.Values, " ") != "3" {
+		t.Errorf("after: expected 200 3: got %d %+v", status, result)
+	}
+}
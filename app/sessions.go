@@ -0,0 +1,310 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/mdhender/bel/bel"
+	"github.com/mdhender/bel/router"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// session is a VM that keeps its globals between requests.
+// The VM is not safe for concurrent use, so the session must be
+// locked while evaluating in it.
+type session struct {
+	busy           chan struct{} // holds a token while the session is locked
+	vm             *bel.VM
+	stdout, stderr *outputBuffer
+	cells          int       // pairs retained by the new VM
+	lastUsed       time.Time // guarded by the server's sessions lock
+}
+
+// lock waits until the session is free and locks it.
+// It returns the context's error if the context is done first.
+func (s *session) lock(ctx context.Context) error {
+	select {
+	case s.busy <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// unlock frees the session
+func (s *session) unlock() {
+	<-s.busy
+}
+
+// sessionTable is the set of open sessions, by id
+type sessionTable struct {
+	sync.Mutex
+	m       map[string]*session
+	reaping bool // true while reapSessions is running
+}
+
+// newSessionID returns a random id for a session
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// minReapInterval is the least time between passes of reapSessions,
+// so that a tiny SessionIdle doesn't make it spin
+const minReapInterval = time.Second
+
+// clock returns the current time
+func (srv *Server) clock() time.Time {
+	if srv.now == nil {
+		return time.Now()
+	}
+	return srv.now()
+}
+
+// expireSessions removes sessions that have been idle for longer than
+// SessionIdle. The caller must hold the sessions lock.
+// Requests expire sessions as they go, and reapSessions expires them
+// while there are no requests.
+func (srv *Server) expireSessions(now time.Time) {
+	if srv.SessionIdle <= 0 {
+		return
+	}
+	for id, s := range srv.sessions.m {
+		if now.Sub(s.lastUsed) > srv.SessionIdle {
+			log.Printf("[app] sessions: %s: expired", id)
+			delete(srv.sessions.m, id)
+		}
+	}
+}
+
+// reapSessions expires idle sessions in the background.
+// It runs while any sessions are open and stops when none are.
+func (srv *Server) reapSessions() {
+	interval := srv.SessionIdle / 2
+	if interval < minReapInterval {
+		interval = minReapInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !srv.reap() {
+			return
+		}
+	}
+}
+
+// reap is one pass of reapSessions. It returns false, and marks the
+// reaper as stopped, if there are no sessions left.
+func (srv *Server) reap() bool {
+	srv.sessions.Lock()
+	defer srv.sessions.Unlock()
+	srv.expireSessions(srv.clock())
+	if len(srv.sessions.m) == 0 {
+		srv.sessions.reaping = false
+		return false
+	}
+	return true
+}
+
+// createSession starts a new session.
+// It returns an empty id if there are already MaxSessions open.
+func (srv *Server) createSession() (string, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+	// loading the prelude is slow, so the vm is created before taking
+	// the lock and thrown away if there is no room for it
+	s := &session{busy: make(chan struct{}, 1), stdout: srv.newOutputBuffer(), stderr: srv.newOutputBuffer()}
+	s.vm = srv.newVM(s.stdout, s.stderr)
+	s.cells = s.vm.Retained(0)
+
+	srv.sessions.Lock()
+	defer srv.sessions.Unlock()
+	now := srv.clock()
+	srv.expireSessions(now)
+	if srv.MaxSessions > 0 && len(srv.sessions.m) >= srv.MaxSessions {
+		return "", nil
+	}
+	if srv.sessions.m == nil {
+		srv.sessions.m = make(map[string]*session)
+	}
+	s.lastUsed = now
+	srv.sessions.m[id] = s
+	if srv.SessionIdle > 0 && !srv.sessions.reaping {
+		srv.sessions.reaping = true
+		go srv.reapSessions()
+	}
+	return id, nil
+}
+
+// lookupSession returns the session with the given id, or nil if
+// there isn't one. Looking up a session counts as using it.
+func (srv *Server) lookupSession(id string) *session {
+	srv.sessions.Lock()
+	defer srv.sessions.Unlock()
+	now := srv.clock()
+	srv.expireSessions(now)
+	s, ok := srv.sessions.m[id]
+	if !ok {
+		return nil
+	}
+	s.lastUsed = now
+	return s
+}
+
+// deleteSession removes a session and returns true if it was open
+func (srv *Server) deleteSession(id string) bool {
+	srv.sessions.Lock()
+	defer srv.sessions.Unlock()
+	srv.expireSessions(srv.clock())
+	if _, ok := srv.sessions.m[id]; !ok {
+		return false
+	}
+	delete(srv.sessions.m, id)
+	return true
+}
+
+// Handler supports
+//
+//	POST   /sessions
+//	POST   /sessions/{id}/eval
+//	DELETE /sessions/{id}
+func (srv *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	id, rest := router.Split(r.URL.Path)
+	switch {
+	case id == "" && r.Method == "POST":
+		id, err := srv.createSession()
+		if err != nil {
+			log.Printf("[app] sessions: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if id == "" {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("[app] sessions: %s: created", id)
+		srv.respond(w, r, struct {
+			ID string `json:"id"`
+		}{ID: id}, http.StatusCreated)
+		return
+	case id == "":
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	case rest == "/" && r.Method == "DELETE":
+		if !srv.deleteSession(id) {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		log.Printf("[app] sessions: %s: deleted", id)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case rest == "/":
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	case rest == "/eval" && r.Method == "POST":
+		srv.handleSessionEval(w, r, id)
+		return
+	case rest == "/eval":
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	default:
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+}
+
+// handleSessionEval evaluates the source in the request in a session.
+// Requests for the same session are evaluated one at a time. A request
+// that waits longer than EvalTimeout for the session fails.
+// If the session keeps more than SessionCells pairs afterwards, it is
+// closed, since later requests can't free them.
+func (srv *Server) handleSessionEval(w http.ResponseWriter, r *http.Request, id string) {
+	s := srv.lookupSession(id)
+	if s == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	src, err := srv.readSource(w, r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if srv.EvalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, srv.EvalTimeout)
+		defer cancel()
+	}
+	result, status, err := srv.evalSession(ctx, r.Context(), id, s, src)
+	if err != nil {
+		log.Printf("[app] sessions: %s: eval: %v", id, err)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	// a long evaluation shouldn't count against the idle time
+	srv.lookupSession(id)
+
+	log.Printf("[app] sessions: %s: eval: %d bytes: status %d", id, len(src), status)
+	srv.respond(w, r, result, status)
+}
+
+// evalSession locks the session and evaluates the source in it. It
+// returns an error if the wait context is done before the session is
+// free. A session whose VM panicked is closed, since its state can't
+// be trusted.
+func (srv *Server) evalSession(wait, ctx context.Context, id string, s *session, src string) (evalResult, int, error) {
+	if err := s.lock(wait); err != nil {
+		return evalResult{}, 0, err
+	}
+	defer s.unlock()
+
+	s.stdout.Reset()
+	s.stderr.Reset()
+	result, status := srv.evalSource(ctx, s.vm, src, s.stdout, s.stderr)
+	if status == http.StatusInternalServerError {
+		srv.deleteSession(id)
+		log.Printf("[app] sessions: %s: closed: internal error", id)
+		return result, status, nil
+	}
+	max := s.cells + srv.SessionCells
+	if srv.SessionCells > 0 && s.vm.Retained(max) > max {
+		srv.deleteSession(id)
+		log.Printf("[app] sessions: %s: closed: cell limit exceeded", id)
+		result.Error = &evalError{Kind: "limit", Message: "session cell limit exceeded"}
+		status = http.StatusUnprocessableEntity
+	}
+	return result, status, nil
+}
@@ -0,0 +1,229 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// createTestSession opens a session and returns its id
+func createTestSession(t *testing.T, srv *Server) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("POST", "/sessions", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected %d: got %d", http.StatusCreated, w.Code)
+	}
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.ID == "" {
+		t.Fatalf("create: expected an id: got %q %v", body.ID, err)
+	}
+	return body.ID
+}
+
+// openSessions returns the number of sessions in the table
+func openSessions(srv *Server) int {
+	srv.sessions.Lock()
+	defer srv.sessions.Unlock()
+	return len(srv.sessions.m)
+}
+
+func TestSessions(t *testing.T) {
+	srv := NewServer(0)
+	srv.MaxSessions = 2
+	id := createTestSession(t, srv)
+
+	// globals are kept between requests
+	for _, tc := range []struct {
+		body   string
+		values string
+	}{
+		{`(set x 1) (def f (n) (+ n x))`, "1 (lit clo nil (n) (+ n x))"},
+		{`(++ x) (f 10)`, "2 12"},
+	} {
+		status, result := post(t, srv, "/sessions/"+id+"/eval", "text/plain", tc.body)
+		if status != http.StatusOK {
+			t.Errorf("%s: expected %d: got %d %+v", tc.body, http.StatusOK, status, result.Error)
+		} else if got := strings.Join(result.Values, " "); got != tc.values {
+			t.Errorf("%s: expected %s: got %s", tc.body, tc.values, got)
+		}
+	}
+	// but not between sessions
+	other := createTestSession(t, srv)
+	if status, _ := post(t, srv, "/sessions/"+other+"/eval", "text/plain", `x`); status != http.StatusUnprocessableEntity {
+		t.Errorf("other session: expected %d: got %d", http.StatusUnprocessableEntity, status)
+	}
+
+	// no more than MaxSessions may be open
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("POST", "/sessions", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("create past max: expected %d: got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	// deleting a session makes room for another
+	for _, expect := range []int{http.StatusNoContent, http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest("DELETE", "/sessions/"+id, nil))
+		if w.Code != expect {
+			t.Errorf("delete: expected %d: got %d", expect, w.Code)
+		}
+	}
+	if status, _ := post(t, srv, "/sessions/"+id+"/eval", "text/plain", `x`); status != http.StatusNotFound {
+		t.Errorf("eval after delete: expected %d: got %d", http.StatusNotFound, status)
+	}
+	createTestSession(t, srv)
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/sessions", http.StatusMethodNotAllowed},
+		{"GET", "/sessions/" + other, http.StatusMethodNotAllowed},
+		{"GET", "/sessions/" + other + "/eval", http.StatusMethodNotAllowed},
+		{"POST", "/sessions/" + other + "/x", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.status {
+			t.Errorf("%s %s: expected %d: got %d", tc.method, tc.path, tc.status, w.Code)
+		}
+	}
+}
+
+// fakeClock is a clock that only moves when the test advances it
+type fakeClock struct {
+	sync.Mutex
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestSessionExpiry(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	srv := NewServer(0)
+	srv.now = clock.now
+	id := createTestSession(t, srv)
+
+	// a session that has been used recently is kept
+	clock.advance(srv.SessionIdle / 2)
+	if !srv.reap() || openSessions(srv) != 1 {
+		t.Errorf("active: expected the session to be kept")
+	}
+
+	// the reaper expires sessions without any requests
+	clock.advance(srv.SessionIdle)
+	if srv.reap() {
+		t.Errorf("idle: expected the reaper to stop")
+	}
+	if n := openSessions(srv); n != 0 {
+		t.Errorf("idle: expected no sessions: got %d", n)
+	}
+	if status, _ := post(t, srv, "/sessions/"+id+"/eval", "text/plain", `1`); status != http.StatusNotFound {
+		t.Errorf("eval after expiry: expected %d: got %d", http.StatusNotFound, status)
+	}
+
+	// and so do requests
+	id = createTestSession(t, srv)
+	clock.advance(srv.SessionIdle + time.Second)
+	if status, _ := post(t, srv, "/sessions/"+id+"/eval", "text/plain", `1`); status != http.StatusNotFound {
+		t.Errorf("eval after expiry: expected %d: got %d", http.StatusNotFound, status)
+	}
+
+	// a tiny idle time doesn't stop the reaper from starting
+	tiny := NewServer(0)
+	tiny.SessionIdle = time.Nanosecond
+	createTestSession(t, tiny)
+}
+
+func TestSessionPanic(t *testing.T) {
+	srv := NewServer(0)
+	id := createTestSession(t, srv)
+
+	// a panic in the interpreter is an internal error and closes the session
+	srv.lookupSession(id).vm = nil
+	status, result := post(t, srv, "/sessions/"+id+"/eval", "text/plain", `1`)
+	if status != http.StatusInternalServerError || result.Error == nil || result.Error.Kind != "internal" {
+		t.Errorf("panic: expected %d internal: got %d %+v", http.StatusInternalServerError, status, result.Error)
+	}
+	if status, _ := post(t, srv, "/sessions/"+id+"/eval", "text/plain", `1`); status != http.StatusNotFound {
+		t.Errorf("after panic: expected %d: got %d", http.StatusNotFound, status)
+	}
+}
+
+func TestSessionBusy(t *testing.T) {
+	srv := NewServer(0)
+	srv.EvalTimeout = 50 * time.Millisecond
+	id := createTestSession(t, srv)
+
+	// a request that can't get the session gives up
+	s := srv.lookupSession(id)
+	s.busy <- struct{}{}
+	if status, _ := post(t, srv, "/sessions/"+id+"/eval", "text/plain", `1`); status != http.StatusServiceUnavailable {
+		t.Errorf("busy: expected %d: got %d", http.StatusServiceUnavailable, status)
+	}
+	s.unlock()
+	if status, _ := post(t, srv, "/sessions/"+id+"/eval", "text/plain", `1`); status != http.StatusOK {
+		t.Errorf("free: expected %d: got %d", http.StatusOK, status)
+	}
+}
+
+func TestSessionCells(t *testing.T) {
+	srv := NewServer(0)
+	srv.SessionCells = 1000
+	id := createTestSession(t, srv)
+
+	// each request is within the limits, but together they keep too much
+	path := "/sessions/" + id + "/eval"
+	src := `(def mk (n) (if (= n 0) nil (cons n (mk (- n 1))))) (set x (mk 400))`
+	if status, result := post(t, srv, path, "text/plain", src); status != http.StatusOK {
+		t.Fatalf("first: expected %d: got %d %+v", http.StatusOK, status, result.Error)
+	}
+	status, result := post(t, srv, path, "text/plain", `(set y (mk 400) z (mk 400)) nil`)
+	if status != http.StatusUnprocessableEntity || result.Error == nil || result.Error.Kind != "limit" {
+		t.Errorf("second: expected %d limit: got %d %+v", http.StatusUnprocessableEntity, status, result.Error)
+	}
+	if status, _ := post(t, srv, path, "text/plain", `1`); status != http.StatusNotFound {
+		t.Errorf("after limit: expected %d: got %d", http.StatusNotFound, status)
+	}
+}
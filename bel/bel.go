@@ -27,8 +27,10 @@ package bel
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 )
 
@@ -36,6 +38,9 @@ import (
 type VM struct {
 	initFiles []string
 
+	noPrelude      bool            // set by WithoutPrelude
+	preludeResults []PreludeResult // outcome of loading the prelude
+
 	// nil is the ubiquitous empty list
 	t     *cell       // t is the truthy cell.cell
 	o     *cell       // something?
@@ -44,19 +49,61 @@ type VM struct {
 	outs  []io.Writer // default output cellStream
 	errs  []io.Writer // default error cellStream
 
-	frames  frameStack
-	scanner *scanner
+	// symbols is the intern table.
+	// it is owned by the VM so that symbols are never shared between VMs.
+	// The exceptions are nil and t, which are constants.
+	// wellKnown holds the symbols in it that the interpreter recognizes.
+	symbols map[string]*cell
+	wellKnown
+
+	// forms are the special forms and opprims are the primitives that
+	// are implemented as op codes, keyed by this VM's symbols.
+	forms   map[*cell]opcode
+	opprims map[*cell]opcode
+
+	// globe is the global environment, a table of variable to binding.
+	// prims maps the name of each primitive to its implementation.
+	// vmark is the marker for the unique variables that uvar creates.
+	globe map[*cell]*cell
+	prims map[*cell]*primitive
+	vmark *cell
+
+	frames   frameStack
+	scanners []*scanner // tokenizers for ins, in the same order
+
+	loadReaders int // inputs at the front of ins that were pushed by load
+
+	interrupted int32 // set by Interrupt, checked by eval
+
+	rng     *rand.Rand // for rand, created on first use
+	noFiles bool       // set by WithoutFiles
+
+	tracer Tracer          // receives events, if not nil
+	limits Limits          // set by WithLimits
+	ctx    context.Context // of the current evaluation, if not nil
+	steps  int             // op codes executed by the current evaluation
+	cells  int             // pairs allocated with cons
+	polls  int             // calls to poll by the current evaluation
 
 	// following are used during eval
 	global struct {
 		args             *cell
+		code             *cell
 		env              *cell
 		op               opcode
+		value            *cell
+		values           []*cell          // values of top level expressions
+		labels           map[string]*cell // labels for shared structure
 		saveRegisters    *cell
 		currentEnv       *cell
+		dynEnv           *cell // dynamic bindings, innermost first
 		currentToken     *token
 		printFlag        int
+		rdr              *scanner // scanner for the expression being read
+		printer          *printer // state for the object being printed
+		position         Position // position of the top level expression being evaluated
 		isTopLevel       bool
+		signalled        *Error // the error being reported, if it was signalled
 		tempOutputStream *cell
 	}
 }
@@ -65,20 +112,93 @@ type stream struct {
 	name string
 	r    io.Reader
 	w    io.Writer
+	sc   *scanner // created by the first read from the stream
+}
+
+// WithArgv is an option that binds *argv* to a list of the arguments.
+// The arguments are Bel strings.
+func WithArgv(args []string) Option {
+	return func(vm *VM) {
+		argv := _NIL
+		for i := len(args) - 1; i >= 0; i-- {
+			argv = mkpair(mkstring(args[i], true), argv)
+		}
+		vm.defglobal(vm.intern("*argv*"), argv)
+	}
 }
 
-func NewVM(initFiles []string) *VM {
+// WithIO is an option that replaces the console. The VM reads from in
+// and writes output to out and errors to errs instead of the standard
+// input, output, and error.
+func WithIO(in io.Reader, out, errs io.Writer) Option {
+	return func(vm *VM) {
+		vm.ins, vm.scanners = nil, nil
+		vm.pushReader("*stdin*", in)
+		vm.outs, vm.errs = []io.Writer{out}, []io.Writer{errs}
+	}
+}
+
+// WithoutFiles is an option that keeps programs from reading files.
+// A call to load signals no-files, including the call that Load makes.
+func WithoutFiles() Option {
+	return func(vm *VM) {
+		vm.noFiles = true
+	}
+}
+
+// NewVM returns a new virtual machine.
+// Unless the WithoutPrelude option is given, it loads the prelude.
+func NewVM(initFiles []string, opts ...Option) *VM {
 	vm := &VM{
-		t:    _TRUE,
-		ins:  []io.Reader{os.Stdin},
-		outs: []io.Writer{os.Stdout},
-		errs: []io.Writer{os.Stderr},
+		t: _TRUE,
+		symbols: map[string]*cell{
+			"nil": _NIL,
+			"t":   _TRUE,
+		},
+		globe: map[*cell]*cell{},
+		prims: map[*cell]*primitive{},
+		vmark: mkpair(_NIL, _NIL),
+		outs:  []io.Writer{os.Stdout},
+		errs:  []io.Writer{os.Stderr},
 	}
-	vm.global.env = mkpair(_NIL, _NIL)
+	vm.internWellKnown()
+	vm.forms, vm.opprims = vm.mkforms(), vm.mkopprims()
+	vm.pushReader("*stdin*", os.Stdin)
 
-	fmt.Println(_NIL)
-	fmt.Println(_FALSE)
-	fmt.Println(_TRUE)
+	// the lexical environment at the top level is empty
+	vm.global.env = _NIL
+	vm.global.currentEnv, vm.global.dynEnv = _NIL, _NIL
+
+	// every primitive is bound to (lit prim name)
+	for _, p := range primitives {
+		name := vm.intern(p.name)
+		vm.prims[name] = p
+		vm.defglobal(name, mklist(vm._LIT, vm._PRIM, name))
+	}
+	for _, p := range natives {
+		name := vm.intern(p.name)
+		vm.prims[name] = p
+		vm.defglobal(name, mklist(vm._LIT, vm._PRIM, name))
+	}
+	for _, p := range extensions {
+		name := vm.intern(p.name)
+		vm.prims[name] = p
+		vm.defglobal(name, mklist(vm._LIT, vm._PRIM, name))
+	}
+	for name := range vm.opprims {
+		vm.defglobal(name, mklist(vm._LIT, vm._PRIM, name))
+	}
+	vm.defglobal(vm._CHARS, mkchars())
+	vm.defglobal(vm._INS, _NIL)
+	vm.defglobal(vm._OUTS, _NIL)
+	vm.defglobal(vm.intern("vmark"), vm.vmark)
+
+	for _, opt := range opts {
+		opt(vm)
+	}
+	if !vm.noPrelude {
+		vm.loadPrelude()
+	}
 
 	// we want to guarantee that the caller can release parameters
 	for _, name := range initFiles {
@@ -88,18 +208,100 @@ func NewVM(initFiles []string) *VM {
 	return vm
 }
 
+// Run loads the files that the VM was created with.
+// An error in one file is reported to the VM's error output and does
+// not stop the others.
 func (vm *VM) Run() {
 	for _, name := range vm.initFiles {
-		fmt.Printf("(load %q)\n", name)
-		args := mkpair(mkstring(name), _NIL)
-		vm.eval(opcLoad, args)
+		if err := vm.Load(name); err != nil {
+			fmt.Fprintf(vm.errs[0], "error: %v\n", err)
+		}
+	}
+}
+
+// Load reads and evaluates every expression in the named file.
+// It stops at the first error that the program does not handle.
+func (vm *VM) Load(name string) error {
+	vm.begin(nil)
+	_, err := vm.evalForm(mklist(vm._LOAD, mkstring(name, true)))
+	return err
+}
+
+// Execute reads and evaluates every expression in the source.
+// It returns the value of each top level expression. It stops at
+// the first error that the program does not handle and returns the
+// values of the expressions before it along with the error.
+func (vm *VM) Execute(b []byte) ([]Value, error) {
+	return vm.ExecuteContext(context.Background(), b)
+}
+
+// ExecuteContext is Execute with a context. The evaluation stops with
+// the context's error if the context is done before it finishes.
+func (vm *VM) ExecuteContext(ctx context.Context, b []byte) ([]Value, error) {
+	vm.begin(ctx)
+	defer vm.begin(nil)
+	vm.pushReader("source.bel", bytes.NewReader(b))
+	defer vm.popReader()
+
+	var values []Value
+	for {
+		form, err := vm.readForm()
+		if err == io.EOF {
+			return values, nil
+		} else if err != nil {
+			return values, err
+		}
+		v, err := vm.evalFormAt(form, vm.global.position)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, Value{v})
+	}
+}
+
+// Check reads every expression in r without evaluating any of them.
+// It returns the first error found by the reader. The name is used
+// when reporting the position of the error.
+func (vm *VM) Check(name string, r io.Reader) error {
+	vm.begin(nil)
+	vm.pushReader(name, r)
+	defer vm.popReader()
+
+	for {
+		if _, err := vm.readForm(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
 	}
 }
 
-func (vm *VM) Execute(b []byte) ([]*cell, error) {
-	var result []*cell
-	result = append(result, vm.eval(opcLoad, mkpair(mkstreamr("source.bel", bytes.NewReader(b)), _NIL)))
-	return result, nil
+// MacroExpand returns the expansion of a form.
+// If the form is a macro call, it is expanded repeatedly until it is not.
+// Otherwise, the form is returned unchanged.
+func (vm *VM) MacroExpand(form Value) (Value, error) {
+	vm.begin(nil)
+	v, err := vm.evalForm(mklist(vm._MACROEXPAND, mklist(vm._QUOTE, form.cell())))
+	if err != nil {
+		return Nil, err
+	}
+	return Value{v}, nil
+}
+
+// intern returns the symbol with the given name, creating it if needed.
+// Symbols with the same name are always the same cell within a VM.
+func (vm *VM) intern(name string) *cell {
+	if a, ok := vm.symbols[name]; ok {
+		return a
+	}
+	a := mksymbol(name)
+	vm.symbols[name] = a
+	return a
+}
+
+// interactive returns true if the VM is reading from the console
+func (vm *VM) interactive() bool {
+	return vm.scanners[0].name == "*stdin*"
 }
 
 func (vm *VM) read(arg *cell) *cell {
@@ -114,12 +316,15 @@ func (vm *VM) popReader() {
 	if len(vm.ins) == 0 {
 		panic("vm: ins: underflow")
 	}
-	vm.ins[0] = nil
-	vm.ins = vm.ins[1:]
+	vm.ins[0], vm.scanners[0] = nil, nil
+	vm.ins, vm.scanners = vm.ins[1:], vm.scanners[1:]
 }
 
-func (vm *VM) pushReader(r io.Reader) {
+// pushReader makes r the current input stream.
+// The name is used when reporting positions in the input.
+func (vm *VM) pushReader(name string, r io.Reader) {
 	vm.ins = append([]io.Reader{r}, vm.ins...)
+	vm.scanners = append([]*scanner{newScanner(name, r)}, vm.scanners...)
 }
 
 func (vm *VM) popErrorWriter() {
@@ -147,10 +352,6 @@ func (vm *VM) pushWriter(w io.Writer) {
 }
 
 func (vm *VM) puts(str string) {
-	if len(vm.outs) == 0 {
-		fmt.Printf("error: no writer: %q\n", str)
-		return
-	}
 	fmt.Fprint(vm.outs[0], str)
 }
 
@@ -25,8 +25,9 @@
 package bel
 
 import (
-	"fmt"
 	"io"
+	"math/big"
+	"strings"
 )
 
 // cell implements a word of storage.
@@ -52,20 +53,33 @@ const (
 	bfPromise      bitfield = 512   // 0000001000000000
 	bfStream       bitfield = 1024  // 0000010000000000
 	bfOpCode       bitfield = 2048  // 0000100000000000
+	bfChar         bitfield = 4096  // 0001000000000000
 	bfAtom         bitfield = 16384 // 0100000000000000
 )
 
 // object will eventually be the union of the atomic data types
 type object struct {
+	_char   rune // a CHAR is a Unicode code point
 	_string string
 	_number number
 	_pair   pair
 	_stream stream
+	_cont   continuation
 }
 
-// number is just a plain integer for the moment
+// continuation is the state needed to resume an evaluation.
+// See ccc in eval.go for the details.
+type continuation struct {
+	frames []*frame
+	env    *cell
+	dyn    *cell
+}
+
+// number is a complex number with rational parts.
+// See number.go for the details.
 type number struct {
-	_ivalue int
+	_real *big.Rat
+	_imag *big.Rat
 }
 
 // pair is a cons cell
@@ -74,8 +88,29 @@ type pair struct {
 	_cdr *cell
 }
 
+// asstring returns the text of a STRING.
+// Both Go strings and Bel strings (lists of CHAR) are accepted.
+// A circular list is cut short instead of being walked forever.
 func asstring(a *cell) string {
-	return a._object._string
+	if (a._flag & bfString) != 0 {
+		return a._object._string
+	}
+	var sb strings.Builder
+	for slow := a; ispair(a); {
+		sb.WriteRune(aschar(car(a)))
+		if a = cdr(a); !ispair(a) {
+			break
+		}
+		sb.WriteRune(aschar(car(a)))
+		if a, slow = cdr(a), cdr(slow); a == slow {
+			break
+		}
+	}
+	return sb.String()
+}
+
+func aschar(a *cell) rune {
+	return a._object._char
 }
 
 func car(a *cell) *cell {
@@ -86,6 +121,18 @@ func cdr(a *cell) *cell {
 	return a._object._pair._cdr
 }
 
+func ischar(a *cell) bool {
+	return (a._flag & bfChar) != 0
+}
+
+func iscontinuation(a *cell) bool {
+	return (a._flag & bfContinuation) != 0
+}
+
+func isnumber(a *cell) bool {
+	return (a._flag & bfNumber) != 0
+}
+
 func ispair(a *cell) bool {
 	return (a._flag & bfPair) != 0
 }
@@ -94,23 +141,59 @@ func isstream(a *cell) bool {
 	return (a._flag & bfStream) != 0
 }
 
+// isstring returns true if the cell is a Go string or a Bel string.
+// A Bel string is a proper list of CHAR cells, so nil is the empty string.
+// A circular list is not a string.
 func isstring(a *cell) bool {
-	return (a._flag & bfString) != 0
+	if (a._flag & bfString) != 0 {
+		return true
+	}
+	// slow moves one pair for every two that a moves, so they meet
+	// if the list is circular
+	for slow := a; ispair(a); {
+		if !ischar(car(a)) {
+			return false
+		} else if a = cdr(a); !ispair(a) {
+			break
+		} else if !ischar(car(a)) {
+			return false
+		} else if a, slow = cdr(a), cdr(slow); a == slow {
+			return false
+		}
+	}
+	return a == _NIL
+}
+
+func issymbol(a *cell) bool {
+	return (a._flag & bfSymbol) != 0
 }
 
-func mknumber(ivalue int) *cell {
+// mkchar creates a new CHAR cell
+func mkchar(r rune) *cell {
 	return &cell{
-		_flag: bfNumber,
+		_flag: bfChar,
 		_object: object{
-			_number: number{
-				_ivalue: ivalue,
+			_char: r,
+		},
+	}
+}
+
+// mkcontinuation creates a new CONTINUATION cell.
+// The frames are copied so that later pushes and pops don't change them.
+func mkcontinuation(frames []*frame, env, dyn *cell) *cell {
+	return &cell{
+		_flag: bfContinuation,
+		_object: object{
+			_cont: continuation{
+				frames: append([]*frame(nil), frames...),
+				env:    env,
+				dyn:    dyn,
 			},
 		},
 	}
 }
 
 func mkpair(car, cdr *cell) *cell {
-	fmt.Printf("(mkpair %s %s)\n", car, cdr)
 	return &cell{
 		_flag: bfPair,
 		_object: object{
@@ -156,8 +239,21 @@ func mkstreamw(name string, w io.Writer) *cell {
 	}
 }
 
-// mkstring creates a new STRING cell
-func mkstring(s string) *cell {
+// mkstring creates a new STRING cell.
+// If aslist is true, it creates a Bel string instead, which is a
+// proper list of CHAR cells that car and cdr can walk.
+func mkstring(s string, aslist bool) *cell {
+	if aslist {
+		var rs []rune
+		for _, r := range s {
+			rs = append(rs, r)
+		}
+		list := _NIL
+		for i := len(rs) - 1; i >= 0; i-- {
+			list = mkpair(mkchar(rs[i]), list)
+		}
+		return list
+	}
 	return &cell{
 		_flag: bfString,
 		_object: object{
@@ -166,6 +262,22 @@ func mkstring(s string) *cell {
 	}
 }
 
+// mksymbol creates a new SYMBOL cell.
+// The symbol is not interned; use VM.intern to get the shared one.
+func mksymbol(name string) *cell {
+	return &cell{
+		_flag: bfSymbol,
+		_object: object{
+			_string: name,
+		},
+	}
+}
+
+// symbolName returns the name of a SYMBOL
+func symbolName(a *cell) string {
+	return a._object._string
+}
+
 func setcar(a, b *cell) {
 	a._object._pair._car = b
 }
@@ -174,24 +286,9 @@ func setcdr(a, b *cell) {
 	a._object._pair._cdr = b
 }
 
+// String returns the cell in Bel notation
 func (a *cell) String() string {
-	if a == _NIL {
-		return "()"
-	} else if a == _FALSE {
-		return "#f"
-	} else if a == _TRUE {
-		return "#t"
-	} else if ispair(a) {
-		return fmt.Sprintf("(%s . %s)", car(a), cdr(a))
-	} else if isstream(a) {
-		if a._object._stream.r != nil {
-			return "#reader"
-		} else if a._object._stream.w != nil {
-			return "#writer"
-		}
-		return "#?stream?"
-	} else if isstring(a) {
-		return fmt.Sprintf("%q", a._object._string)
-	}
-	return "#unknown"
+	var sb strings.Builder
+	newPrinter(a).sprint(&sb, a)
+	return sb.String()
 }
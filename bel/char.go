@@ -0,0 +1,130 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Bel treats characters as fundamental, but it represents each one
+// as a string of bits so that streams can be read and written a bit
+// at a time. We use the bits of the UTF-8 encoding, so the ASCII
+// characters have the 8-bit representation that Bel specifies:
+//   \a <-> "01100001"
+
+// charbits returns the binary representation of a character
+func charbits(r rune) string {
+	var buf [utf8.UTFMax]byte
+	var sb strings.Builder
+	for _, b := range buf[:utf8.EncodeRune(buf[:], r)] {
+		for mask := byte(0x80); mask != 0; mask >>= 1 {
+			if b&mask != 0 {
+				sb.WriteByte('1')
+			} else {
+				sb.WriteByte('0')
+			}
+		}
+	}
+	return sb.String()
+}
+
+// bitschar returns the character with the given binary representation
+func bitschar(bits string) (rune, error) {
+	if len(bits) == 0 || len(bits)%8 != 0 {
+		return 0, errors.New("bad-char-bits")
+	}
+	buf := make([]byte, 0, len(bits)/8)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for _, bit := range bits[i : i+8] {
+			switch bit {
+			case '0':
+				b = b << 1
+			case '1':
+				b = b<<1 | 1
+			default:
+				return 0, errors.New("bad-char-bits")
+			}
+		}
+		buf = append(buf, b)
+	}
+	// a well-formed U+FFFD decodes to RuneError too, but in 3 bytes
+	r, size := utf8.DecodeRune(buf)
+	if (r == utf8.RuneError && size == 1) || size != len(buf) {
+		return 0, errors.New("bad-char-bits")
+	}
+	return r, nil
+}
+
+// mkbits returns the binary representation of a CHAR as a
+// Bel string of \1 and \0 characters
+func mkbits(a *cell) *cell {
+	return mkstring(charbits(aschar(a)), true)
+}
+
+// frombits returns the CHAR represented by a Bel string of
+// \1 and \0 characters
+func frombits(bits *cell) (*cell, error) {
+	if !isstring(bits) {
+		return nil, errors.New("bad-char-bits")
+	}
+	r, err := bitschar(asstring(bits))
+	if err != nil {
+		return nil, err
+	}
+	return mkchar(r), nil
+}
+
+// primCharBits implements (char-bits c), which returns the binary
+// representation of a character
+func primCharBits(vm *VM, args []*cell) (*cell, error) {
+	if !ischar(args[0]) {
+		return nil, errors.New("mistype")
+	}
+	return vm.chars(charbits(aschar(args[0]))), nil
+}
+
+// primBitsChar implements (bits-char s), which returns the character
+// with the given binary representation
+func primBitsChar(vm *VM, args []*cell) (*cell, error) {
+	return frombits(args[0])
+}
+
+// mkchars returns the list that Bel calls chars.
+// Its elements are of the form (c . b), where c is a character and
+// b is its binary representation.
+// Bel doesn't specify which characters are in the list, but it must
+// include at least those in the Bel source, so we include the first
+// 256 code points.
+func mkchars() *cell {
+	list := _NIL
+	for r := rune(255); r >= 0; r-- {
+		c := mkchar(r)
+		list = mkpair(mkpair(c, mkbits(c)), list)
+	}
+	return list
+}
@@ -0,0 +1,99 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCharBits(t *testing.T) {
+	for _, tc := range []struct {
+		ch   rune
+		bits string
+	}{
+		{'a', "01100001"},
+		{'\n', "00001010"},
+		{'é', "1100001110101001"},
+		{'\uFFFD', "111011111011111110111101"},
+	} {
+		if got := charbits(tc.ch); got != tc.bits {
+			t.Errorf("charbits %q: expected %s: got %s", tc.ch, tc.bits, got)
+		}
+		if got, err := bitschar(tc.bits); err != nil {
+			t.Errorf("bitschar %s: %v", tc.bits, err)
+		} else if got != tc.ch {
+			t.Errorf("bitschar %s: expected %q: got %q", tc.bits, tc.ch, got)
+		}
+	}
+	// 11111111 is not valid UTF-8 and 11101101 10100000 10000000 is a surrogate
+	for _, bits := range []string{"", "0110000", "0110000x", "11000011", "11111111", "111011011010000010000000"} {
+		if _, err := bitschar(bits); err == nil {
+			t.Errorf("bitschar %q: expected error", bits)
+		}
+	}
+
+	vm := NewVM(nil, WithoutPrelude())
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(char-bits \a)`, `"01100001"`},
+		{`(bits-char "01100001")`, `\a`},
+		{`(bits-char (char-bits \é))`, `\é`},
+		{`(bits-char (char-bits \�))`, `\�`},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+	for _, input := range []string{`(char-bits "a")`, `(bits-char "0110")`, `(bits-char '(a))`} {
+		if _, err := vm.Eval(context.Background(), input); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+func TestCircularString(t *testing.T) {
+	// (\a \b . #1) where #1 is the list itself
+	a := mkstring("ab", true)
+	setcdr(cdr(a), a)
+	if isstring(a) {
+		t.Errorf("isstring: circular list is a string")
+	}
+	if got := asstring(a); len(got) < 2 || got[:2] != "ab" {
+		t.Errorf("asstring: expected prefix ab: got %q", got)
+	}
+
+	b := mkstring("abc", true)
+	if !isstring(b) {
+		t.Errorf("isstring: proper list is not a string")
+	} else if got := asstring(b); got != "abc" {
+		t.Errorf("asstring: expected abc: got %q", got)
+	}
+}
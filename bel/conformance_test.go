@@ -0,0 +1,147 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// example is one "> expr" / result pair from pgdocs/belexamples.txt
+type example struct {
+	line   int    // line of the prompt in the file
+	input  string // the expression, without the prompt
+	expect string // the printed result, or "Error: name" for an error
+}
+
+// parseExamples returns the examples in the order they appear.
+// An example starts with a "> " prompt. Indented lines that follow it
+// continue the expression, and the lines after that up to the next
+// prompt or blank line are the expected result.
+func parseExamples(r io.Reader) ([]example, error) {
+	var examples []example
+	var cur *example
+	inResult := false
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		switch {
+		case strings.HasPrefix(text, "> "):
+			examples = append(examples, example{line: line, input: strings.TrimPrefix(text, "> ")})
+			cur, inResult = &examples[len(examples)-1], false
+		case cur == nil:
+		case strings.TrimSpace(text) == "":
+			cur = nil
+		case !inResult && (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")):
+			cur.input += "\n" + text
+		default:
+			if inResult {
+				cur.expect += "\n"
+			}
+			cur.expect += text
+			inResult = true
+		}
+	}
+	return examples, sc.Err()
+}
+
+// unimplemented are the examples, by line, that use features the
+// interpreter does not support yet.
+var unimplemented = map[int]string{
+	61: "files",
+	63: "files",
+}
+
+// errata are the examples, by line, whose expected results disagree
+// with the language guide.
+var errata = map[int]string{
+	44: "the guide says sym signals an error if its argument is not a string",
+}
+
+// TestExamples runs the examples from pgdocs/belexamples.txt in order in
+// a single VM, since later examples use values set by earlier ones.
+// Each example is a subtest, so go test -v reports pass, fail, or skip
+// for each one.
+func TestExamples(t *testing.T) {
+	fp, err := os.Open("../pgdocs/belexamples.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	examples, err := parseExamples(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVM(nil)
+	errs := &bytes.Buffer{}
+	vm.errs = []io.Writer{errs}
+
+	var passed, failed, skipped int
+	for _, ex := range examples {
+		t.Run(fmt.Sprintf("line%03d", ex.line), func(t *testing.T) {
+			if reason, ok := unimplemented[ex.line]; ok {
+				skipped++
+				t.Skipf("%s: not implemented: %s", ex.input, reason)
+			} else if reason, ok := errata[ex.line]; ok {
+				skipped++
+				t.Skipf("%s: erratum: %s", ex.input, reason)
+			}
+			errs.Reset()
+			values, err := vm.Execute([]byte(ex.input))
+			var got string
+			if err != nil {
+				got = "Error: " + err.Error()
+			} else if errs.Len() != 0 {
+				got = errs.String()
+			} else if len(values) != 1 {
+				got = fmt.Sprintf("%d values", len(values))
+			} else {
+				got = values[0].String()
+			}
+			if strings.HasPrefix(ex.expect, "Error: ") {
+				// the interpreter's messages differ from the guide's,
+				// so only the name of the error has to match
+				name := strings.TrimPrefix(ex.expect, "Error: ")
+				if !strings.Contains(got, name) {
+					failed++
+					t.Errorf("%s: expected error %q: got %q", ex.input, name, got)
+					return
+				}
+			} else if got != ex.expect {
+				failed++
+				t.Errorf("%s: expected %q: got %q", ex.input, ex.expect, got)
+				return
+			}
+			passed++
+		})
+	}
+	t.Logf("examples: %d passed, %d failed, %d skipped", passed, failed, skipped)
+}
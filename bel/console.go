@@ -0,0 +1,121 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// console is the input stream for an interactive session.
+// It reads a line at a time so that it can display a continuation
+// prompt when an expression is not complete at the end of a line.
+// It implements io.RuneScanner so that the scanner reads from it directly.
+type console struct {
+	vm      *VM
+	r       *bufio.Reader
+	history io.Writer // lines read are appended here, if not nil
+	line    []rune    // the line being read
+	pos     int       // index of the next rune in line
+	primary bool      // true if the primary prompt was just displayed
+}
+
+// ReadRune implements the io.RuneReader interface.
+// When the line is exhausted it reads another, displaying the
+// continuation prompt unless the top level just displayed the primary one.
+func (c *console) ReadRune() (rune, int, error) {
+	for c.pos >= len(c.line) {
+		if !c.primary {
+			c.vm.puts("...  ")
+		}
+		c.primary = false
+		s, err := c.r.ReadString('\n')
+		if s == "" && err != nil {
+			return 0, 0, err
+		}
+		if c.history != nil && strings.TrimSpace(s) != "" {
+			io.WriteString(c.history, strings.TrimRight(s, "\n")+"\n")
+		}
+		// an interrupt while waiting for input has nothing to interrupt
+		atomic.StoreInt32(&c.vm.interrupted, 0)
+		c.line, c.pos = []rune(s), 0
+	}
+	ch := c.line[c.pos]
+	c.pos++
+	return ch, len(string(ch)), nil
+}
+
+// Read implements the io.Reader interface.
+// It returns no more than the rest of the line being read.
+func (c *console) Read(p []byte) (n int, err error) {
+	for n < len(p) && (n == 0 || c.pos < len(c.line)) {
+		ch, size, err := c.ReadRune()
+		if err != nil {
+			return n, err
+		} else if n+size > len(p) {
+			c.UnreadRune()
+			break
+		}
+		n += utf8.EncodeRune(p[n:], ch)
+	}
+	return n, nil
+}
+
+// UnreadRune implements the io.RuneScanner interface.
+func (c *console) UnreadRune() error {
+	if c.pos == 0 {
+		return bufio.ErrInvalidUnreadRune
+	}
+	c.pos--
+	return nil
+}
+
+// Interact runs an interactive session that reads from in until it
+// is exhausted. Each line that is read is appended to history, which
+// may be nil.
+func (vm *VM) Interact(in io.Reader, history io.Writer) error {
+	c := &console{vm: vm, r: bufio.NewReader(in), history: history}
+	vm.pushReader("*stdin*", c)
+	defer vm.popReader()
+	_, err := vm.eval(opcTopLevel0, _NIL)
+	return err
+}
+
+// Interrupt stops the expression being evaluated and returns to the top level.
+// It is safe to call from another goroutine, such as a signal handler.
+func (vm *VM) Interrupt() {
+	atomic.StoreInt32(&vm.interrupted, 1)
+}
+
+// prompt displays the primary prompt for an interactive session
+func (vm *VM) prompt() {
+	vm.puts("bel> ")
+	if c, ok := vm.scanners[0].r.(*console); ok {
+		c.primary = true
+	}
+}
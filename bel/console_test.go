@@ -0,0 +1,54 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInteract(t *testing.T) {
+	out, errs := &bytes.Buffer{}, &bytes.Buffer{}
+	vm := NewVM(nil, WithoutPrelude(), WithIO(strings.NewReader(""), out, errs))
+	history := &bytes.Buffer{}
+	input := "(join 1\n  2)\n(car 'a)\n\n'x\n"
+	if err := vm.Interact(strings.NewReader(input), history); err != nil {
+		t.Fatal(err)
+	}
+	if expect := "\nbel> ...  (1 . 2)\nbel> \nbel> ...  x\nbel> "; out.String() != expect {
+		t.Errorf("output: expected %q: got %q", expect, out.String())
+	}
+	if !strings.Contains(errs.String(), "car-on-atom") {
+		t.Errorf("errors: expected car-on-atom: got %q", errs.String())
+	}
+	if expect := "(join 1\n  2)\n(car 'a)\n'x\n"; history.String() != expect {
+		t.Errorf("history: expected %q: got %q", expect, history.String())
+	}
+	// the console is popped when the session ends
+	if len(vm.ins) != 1 {
+		t.Errorf("inputs: expected 1: got %d", len(vm.ins))
+	}
+}
@@ -24,17 +24,126 @@
 
 package bel
 
-// NIL is a special cell representing the empty list
-var _NIL *cell
+// NIL is a special cell representing the empty list.
+// It is also the symbol nil.
+var _NIL = mkselfsymbol("nil")
 
 // FALSE is a special cell representing #f
-var _FALSE *cell
+var _FALSE = mkself()
 
-// TRUE is a special cell representing #t
-var _TRUE *cell
+// TRUE is a special cell representing truth.
+// It is also the symbol t.
+var _TRUE = mkselfsymbol("t")
 
-func init() {
-	_NIL = mkself()   // special cell representing the empty list
-	_FALSE = mkself() // special cell representing #f
-	_TRUE = mkself()  // special cell representing #t
+// mkselfsymbol creates a self-linking ATOM that is also a symbol.
+// nil and t are symbols that every VM shares. They are initialized
+// with the package's variables, rather than in init, so that variables
+// such as Nil and T can refer to them.
+func mkselfsymbol(name string) *cell {
+	a := mkself()
+	a._flag, a._object._string = a._flag|bfSymbol, name
+	return a
+}
+
+// wellKnown are the symbols that the interpreter must recognize.
+// Each VM interns its own when it is created, so that the interpreter
+// can compare against them by identity without sharing them with
+// other VMs.
+type wellKnown struct {
+	_A            *cell
+	_AFTER        *cell
+	_APPEND       *cell
+	_APPLY        *cell
+	_ARR          *cell
+	_BQUOTE       *cell
+	_CAR          *cell
+	_CCC          *cell
+	_CDR          *cell
+	_CHAR         *cell
+	_CHARS        *cell
+	_CLO          *cell
+	_COMMA        *cell
+	_COMMAAT      *cell
+	_CONT         *cell
+	_D            *cell
+	_DEF          *cell
+	_DO           *cell
+	_DYN          *cell
+	_ERR          *cell
+	_FN           *cell
+	_GLOBE        *cell
+	_IF           *cell
+	_INS          *cell
+	_JOIN         *cell
+	_LIT          *cell
+	_LOAD         *cell
+	_MAC          *cell
+	_MACRO        *cell
+	_MACROEXPAND  *cell
+	_MACROEXPAND1 *cell
+	_NUM          *cell
+	_O            *cell
+	_ONERR        *cell
+	_OUTS         *cell
+	_PAIR         *cell
+	_PRIM         *cell
+	_QUOTE        *cell
+	_READ         *cell
+	_SAFE         *cell
+	_SCOPE        *cell
+	_SET          *cell
+	_STREAM       *cell
+	_SYMBOL       *cell
+	_TAB          *cell
+	_WHERE        *cell
+}
+
+// internWellKnown interns the symbols that the interpreter must recognize
+func (vm *VM) internWellKnown() {
+	vm._A = vm.intern("a")
+	vm._AFTER = vm.intern("after")
+	vm._APPEND = vm.intern("append")
+	vm._APPLY = vm.intern("apply")
+	vm._ARR = vm.intern("arr")
+	vm._BQUOTE = vm.intern("bquote")
+	vm._CAR = vm.intern("car")
+	vm._CCC = vm.intern("ccc")
+	vm._CDR = vm.intern("cdr")
+	vm._CHAR = vm.intern("char")
+	vm._CHARS = vm.intern("chars")
+	vm._CLO = vm.intern("clo")
+	vm._COMMA = vm.intern("comma")
+	vm._COMMAAT = vm.intern("comma-at")
+	vm._CONT = vm.intern("cont")
+	vm._D = vm.intern("d")
+	vm._DEF = vm.intern("def")
+	vm._DO = vm.intern("do")
+	vm._DYN = vm.intern("dyn")
+	vm._ERR = vm.intern("err")
+	vm._FN = vm.intern("fn")
+	vm._GLOBE = vm.intern("globe")
+	vm._IF = vm.intern("if")
+	vm._INS = vm.intern("ins")
+	vm._JOIN = vm.intern("join")
+	vm._LIT = vm.intern("lit")
+	vm._LOAD = vm.intern("load")
+	vm._MAC = vm.intern("mac")
+	vm._MACRO = vm.intern("macro")
+	vm._MACROEXPAND = vm.intern("macroexpand")
+	vm._MACROEXPAND1 = vm.intern("macroexpand-1")
+	vm._NUM = vm.intern("num")
+	vm._O = vm.intern("o")
+	vm._ONERR = vm.intern("onerr")
+	vm._OUTS = vm.intern("outs")
+	vm._PAIR = vm.intern("pair")
+	vm._PRIM = vm.intern("prim")
+	vm._QUOTE = vm.intern("quote")
+	vm._READ = vm.intern("read")
+	vm._SAFE = vm.intern("safe")
+	vm._SCOPE = vm.intern("scope")
+	vm._SET = vm.intern("set")
+	vm._STREAM = vm.intern("stream")
+	vm._SYMBOL = vm.intern("symbol")
+	vm._TAB = vm.intern("tab")
+	vm._WHERE = vm.intern("where")
 }
@@ -0,0 +1,135 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Define binds name to a primitive that calls fn.
+// The arguments are passed as they were given; fn checks their number
+// and types. If fn returns an *Error, its value and irritants are
+// signalled. Any other error is signalled as the symbol go-error, with
+// the error's text as the irritant. If fn panics, the symbol panic is
+// signalled with the panic's value as the irritant.
+func (vm *VM) Define(name string, fn func(args []Value) (Value, error)) {
+	sym := vm.intern(name)
+	vm.prims[sym] = &primitive{
+		name:  name,
+		arity: -1,
+		fn: func(vm *VM, args []*cell) (result *cell, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &Error{Value: Value{vm.intern("panic")}, Irritants: List(String(fmt.Sprint(r)))}
+				}
+			}()
+			argv := make([]Value, len(args))
+			for i, a := range args {
+				argv[i] = Value{a}
+			}
+			v, err := fn(argv)
+			var e *Error
+			if errors.As(err, &e) {
+				return nil, e
+			} else if err != nil {
+				// the text is a string, since interning it would add
+				// a symbol for every message
+				return nil, &Error{Value: Value{vm.intern("go-error")}, Irritants: List(String(err.Error()))}
+			}
+			return v.cell(), nil
+		},
+	}
+	vm.defglobal(sym, mklist(vm._LIT, vm._PRIM, sym))
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// DefineFunc binds name to a primitive that calls fn, which must be a
+// Go function. The arguments are converted to the types of fn's
+// parameters and the results are converted back to Bel values.
+//
+// The parameters and results may be of any type that Marshal and
+// Unmarshal accept.
+//
+// fn may return nothing, a value, an error, or a value and an error.
+// A call with the wrong number of arguments signals overargs or
+// underargs, and an argument that can't be converted signals mistype.
+// An error that fn returns is signalled as it is by Define.
+func (vm *VM) DefineFunc(name string, fn interface{}) error {
+	fv := reflect.ValueOf(fn)
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func {
+		return fmt.Errorf("define %s: %s is not a function", name, ft)
+	}
+	switch {
+	case ft.NumOut() == 0:
+	case ft.NumOut() == 1:
+	case ft.NumOut() == 2 && ft.Out(1) == errorType:
+	default:
+		return fmt.Errorf("define %s: %s returns too many values", name, ft)
+	}
+
+	nfixed := ft.NumIn()
+	if ft.IsVariadic() {
+		nfixed--
+	}
+	vm.Define(name, func(args []Value) (Value, error) {
+		if len(args) < nfixed {
+			return Nil, &Error{Value: vm.Symbol("underargs")}
+		} else if len(args) > nfixed && !ft.IsVariadic() {
+			return Nil, &Error{Value: vm.Symbol("overargs")}
+		}
+		in := make([]reflect.Value, len(args))
+		for i, a := range args {
+			var t reflect.Type
+			if i < nfixed {
+				t = ft.In(i)
+			} else {
+				t = ft.In(nfixed).Elem()
+			}
+			v, err := toGo(a, t)
+			if err == errMistype {
+				return Nil, &Error{Value: vm.Symbol("mistype"), Irritants: List(a)}
+			} else if err != nil {
+				return Nil, err
+			}
+			in[i] = v
+		}
+		out := fv.Call(in)
+		if n := len(out); n != 0 && ft.Out(n-1) == errorType {
+			if err, _ := out[n-1].Interface().(error); err != nil {
+				return Nil, err
+			}
+			out = out[:n-1]
+		}
+		if len(out) == 0 {
+			return Nil, nil
+		}
+		return fromGo(out[0])
+	})
+	return nil
+}
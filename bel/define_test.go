@@ -0,0 +1,202 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDefine(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	vm.Define("count", func(args []Value) (Value, error) {
+		return Int(int64(len(args))), nil
+	})
+	vm.Define("fail", func(args []Value) (Value, error) {
+		return Nil, &Error{Value: vm.Symbol("bad-thing"), Irritants: List(args...)}
+	})
+	vm.Define("oops", func(args []Value) (Value, error) {
+		return Nil, errors.New("oops")
+	})
+	vm.Define("crash", func(args []Value) (Value, error) {
+		var m map[string]int
+		m["x"] = 1
+		return Nil, nil
+	})
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(count)`, "0"},
+		{`(count 1 'a "b")`, "3"},
+		// errors are signalled, so programs can catch them
+		{`(ccc (fn (c) (dyn err (fn (e) (c (join 'caught e))) (fail 1 2))))`, "(caught . bad-thing)"},
+		{`(ccc (fn (c) (dyn err (fn (e) (c (join 'caught e))) (oops))))`, "(caught . go-error)"},
+		{`(ccc (fn (c) (dyn err (fn (e) (c (join 'caught e))) (crash))))`, "(caught . panic)"},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		input     string
+		value     string
+		irritants string
+	}{
+		// an *Error is signalled as it is
+		{`(fail 1 2)`, "bad-thing", "(1 2)"},
+		// other errors are go-error, with their text as the irritant
+		{`(oops 1)`, "go-error", `("oops")`},
+		{`(crash)`, "panic", `("assignment to entry in nil map")`},
+	} {
+		_, err := vm.Eval(context.Background(), tc.input)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: expected *Error: got %T %v", tc.input, err, err)
+		} else if e.Value.String() != tc.value || e.Irritants.String() != tc.irritants {
+			t.Errorf("%s: expected %s %s: got %s %s", tc.input, tc.value, tc.irritants, e.Value, e.Irritants)
+		}
+	}
+}
+
+func TestDefineFunc(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	for name, fn := range map[string]interface{}{
+		"add": func(a, b int) int { return a + b },
+		"join-all": func(sep string, xs ...string) string {
+			return strings.Join(xs, sep)
+		},
+		"half": func(n float64) (float64, error) {
+			if n < 0 {
+				return 0, errors.New("negative")
+			}
+			return n / 2, nil
+		},
+		"nothing": func() {},
+		"index":   func(xs []int, i int) int { return xs[i] },
+	} {
+		if err := vm.DefineFunc(name, fn); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(add 2 3)`, "5"},
+		{`(join-all ", ")`, "nil"},
+		{`(join-all ", " "a" "b" "c")`, `"a, b, c"`},
+		{`(half 3)`, "3/2"},
+		{`(nothing)`, "nil"},
+		{`(index '(4 5 6) 2)`, "6"},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(add 1)`, "underargs"},
+		{`(add 1 2 3)`, "overargs"},
+		{`(join-all)`, "underargs"},
+		{`(add 'a 1)`, "mistype"},
+		{`(add 1/2 1)`, "mistype"},
+		{`(join-all "," "a" 1)`, "mistype"},
+		{`(half -1)`, "go-error"},
+		{`(index '(4 5 6) 3)`, "panic"},
+	} {
+		_, err := vm.Eval(context.Background(), tc.input)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: expected *Error: got %T %v", tc.input, err, err)
+		} else if got := e.Value.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+
+	for name, fn := range map[string]interface{}{
+		"not-a-func":  42,
+		"three-value": func() (int, int, error) { return 0, 0, nil },
+		"no-error":    func() (int, int) { return 0, 0 },
+	} {
+		if err := vm.DefineFunc(name, fn); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// brokenWriter fails every write
+type brokenWriter struct{}
+
+func (brokenWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write /dev/stdout: broken pipe")
+}
+
+func TestGoError(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude(), WithIO(strings.NewReader(""), brokenWriter{}, ioutil.Discard))
+	vm.Define("oops", func(args []Value) (Value, error) {
+		return Nil, fmt.Errorf("oops %d", len(args))
+	})
+	vm.Symbol("go-error")
+	for _, tc := range []struct {
+		input     string
+		irritants string
+	}{
+		{`(oops 1 2)`, `("oops 2")`},
+		{`(pr 'a)`, `("write /dev/stdout: broken pipe" (pr a))`},
+	} {
+		before := len(vm.symbols)
+		_, err := vm.Eval(context.Background(), tc.input)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: expected *Error: got %T %v", tc.input, err, err)
+		} else if e.Value.String() != "go-error" || e.Irritants.String() != tc.irritants {
+			t.Errorf("%s: expected go-error %s: got %s %s", tc.input, tc.irritants, e.Value, e.Irritants)
+		}
+		// the message is not interned
+		if after := len(vm.symbols); after != before {
+			t.Errorf("%s: expected %d symbols: got %d", tc.input, before, after)
+		}
+	}
+
+	// errors that the VM makes are still signalled by name
+	if _, err := vm.Eval(context.Background(), `(car 'a)`); err == nil || err.(*Error).Value.String() != "car-on-atom" {
+		t.Errorf("car: expected car-on-atom: got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+// The environment follows lookup and binding in pgdocs/bel.bel.
+// A binding is a (var . val) pair so that set can update it in place.
+// The lexical environment is a list of bindings, kept in currentEnv.
+// The global environment would be too slow to search as a list, so it
+// is a table, vm.globe, from variable to binding.
+// Dynamic bindings are a list of bindings in dynEnv. They are saved in
+// every frame, so returning from a dyn restores the outer bindings.
+
+// literal returns true if the expression evaluates to itself
+func (vm *VM) literal(e *cell) bool {
+	switch e {
+	case _NIL, _TRUE, vm._O, vm._APPLY:
+		return true
+	}
+	if ischar(e) || isstream(e) || isnumber(e) {
+		return true
+	} else if ispair(e) {
+		return car(e) == vm._LIT || isstring(e)
+	}
+	return isstring(e)
+}
+
+// variable returns true if the expression is a variable.
+// Variables are symbols that aren't literals, and the unique
+// variables that uvar creates, which are lists beginning with vmark.
+func (vm *VM) variable(e *cell) bool {
+	if ispair(e) {
+		return car(e) == vm.vmark
+	}
+	return issymbol(e) && !vm.literal(e)
+}
+
+// proper returns true if the cell is a proper list.
+// A circular list is not proper.
+func proper(a *cell) bool {
+	// slow moves one pair for every two that a moves, so they meet
+	// if the list is circular
+	for slow := a; ispair(a); {
+		if a = cdr(a); !ispair(a) {
+			break
+		} else if a, slow = cdr(a), cdr(slow); a == slow {
+			return false
+		}
+	}
+	return a == _NIL
+}
+
+// lookup returns the binding for a variable, or nil if it is unbound.
+// Dynamic bindings take precedence over lexical bindings, which take
+// precedence over global ones.
+// The variables scope and globe are bound to the lexical and global
+// environments unless they are shadowed.
+func (vm *VM) lookup(v *cell) *cell {
+	for a := vm.global.dynEnv; ispair(a); a = cdr(a) {
+		if b := car(a); car(b) == v {
+			return b
+		}
+	}
+	for a := vm.global.currentEnv; ispair(a); a = cdr(a) {
+		if b := car(a); car(b) == v {
+			return b
+		}
+	}
+	if b, ok := vm.globe[v]; ok {
+		return b
+	}
+	switch v {
+	case vm._SCOPE:
+		return vm.cons(v, vm.global.currentEnv)
+	case vm._GLOBE:
+		return vm.cons(v, vm.globeList())
+	}
+	return nil
+}
+
+// assign sets the value of a variable.
+// If the variable is bound, the binding is updated.
+// Otherwise, a new global binding is created.
+func (vm *VM) assign(v, val *cell) {
+	if b := vm.lookup(v); b != nil && v != vm._SCOPE && v != vm._GLOBE {
+		setcdr(b, val)
+		return
+	}
+	vm.defglobal(v, val)
+}
+
+// defglobal binds a variable in the global environment
+func (vm *VM) defglobal(v, val *cell) {
+	if b, ok := vm.globe[v]; ok {
+		setcdr(b, val)
+		return
+	}
+	vm.globe[v] = vm.cons(v, val)
+}
+
+// globeList returns the global environment as a list of bindings
+func (vm *VM) globeList() *cell {
+	list := _NIL
+	for _, b := range vm.globe {
+		list = vm.cons(b, list)
+	}
+	return list
+}
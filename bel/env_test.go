@@ -0,0 +1,142 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProper(t *testing.T) {
+	circular := func(n int) *cell {
+		list := mklist(mkint(1), mkint(2), mkint(3), mkint(4))
+		last := list
+		for ; cdr(last) != _NIL; last = cdr(last) {
+		}
+		setcdr(last, nth(list, n))
+		return list
+	}
+	for _, tc := range []struct {
+		name   string
+		input  *cell
+		expect bool
+	}{
+		{"nil", _NIL, true},
+		{"atom", mkint(1), false},
+		{"list", mklist(mkint(1), mkint(2), mkint(3)), true},
+		{"dotted", mkpair(mkint(1), mkint(2)), false},
+		{"circular", circular(0), false},
+		{"circular tail", circular(3), false},
+	} {
+		if got := proper(tc.input); got != tc.expect {
+			t.Errorf("%s: expected %v: got %v", tc.name, tc.expect, got)
+		}
+		if got := (Value{tc.input}).IsList(); got != tc.expect {
+			t.Errorf("%s: IsList: expected %v: got %v", tc.name, tc.expect, got)
+		}
+	}
+}
+
+func TestEvalCircular(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	if _, err := vm.Eval(context.Background(), `#1=(car . #1)`); err == nil {
+		t.Errorf("circular form: expected error")
+	} else if e, ok := err.(*Error); !ok || e.Value.String() != "malformed" {
+		t.Errorf("circular form: expected malformed: got %v", err)
+	}
+}
+
+func TestSetPlace(t *testing.T) {
+	vm := NewVM(nil)
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(let x (list 1 2) (set (cadr x) 5) x)`, `(1 5)`},
+		{`(let m (macro (v) v) (set (m fresh1) 10))`, `10`},
+		{`fresh1`, `10`},
+		{`(cdr (car (where fresh2 t)))`, `nil`},
+		{`(let m (macro (v) v) (set (m fresh1) 11) fresh1)`, `11`},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+	if _, err := vm.Eval(context.Background(), `(where fresh3)`); err == nil {
+		t.Errorf("where on an unbound variable: expected error")
+	}
+}
+
+func TestApplyNumber(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(2 '(a b c))`, `b`},
+		{`(3 '(a b))`, `nil`},
+		{`(1 nil)`, `nil`},
+		{`(car (where (2 '(a b c))))`, `(b c)`},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+	for _, input := range []string{`(1 2)`, `(car (1 2))`, `(2 '(a . b))`, `(1)`, `(where (3 '(a b)))`} {
+		if _, err := vm.Eval(context.Background(), input); err == nil {
+			t.Errorf("%s: expected mistype", input)
+		} else if e, ok := err.(*Error); !ok || e.Value.String() != "mistype" {
+			t.Errorf("%s: expected mistype: got %v", input, err)
+		}
+	}
+}
+
+func TestIntern(t *testing.T) {
+	a, b := NewVM(nil, WithoutPrelude()), NewVM(nil, WithoutPrelude())
+	for _, name := range []string{"quote", "lit", "foo"} {
+		if a.MkSymbol(name) != a.MkSymbol(name) {
+			t.Errorf("%s: expected the same symbol within a VM", name)
+		}
+		if a.MkSymbol(name) == b.MkSymbol(name) {
+			t.Errorf("%s: expected different symbols in different VMs", name)
+		}
+	}
+	// nil and t are constants that every VM shares
+	if a.MkSymbol("nil") != _NIL || b.MkSymbol("t") != _TRUE {
+		t.Errorf("nil and t: expected the shared constants")
+	}
+	// each VM recognizes its own symbols
+	for _, vm := range []*VM{a, b} {
+		if v, err := vm.Eval(context.Background(), `(if 'a (quote b))`); err != nil || v.String() != "b" {
+			t.Errorf("special forms: expected b: got %s %v", v, err)
+		}
+	}
+}
@@ -25,25 +25,457 @@
 package bel
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 )
 
-// framePop pops a frame
+// framePop pops a frame and restores the registers saved in it
 func (vm *VM) framePop() {
 	f := vm.frames.pop()
+	if vm.tracer != nil {
+		vm.trace(TracePop, f.op, nil)
+	}
 	vm.global.op = f.op
+	vm.global.args = f.args
+	vm.global.code = f.code
 	vm.global.currentEnv = f.env
+	vm.global.dynEnv = f.dyn
+}
+
+// framePush pushes a frame that will continue with op
+func (vm *VM) framePush(op opcode, args, code *cell) {
+	vm.frames.push(op, vm.global.currentEnv, vm.global.dynEnv, args, code)
+	if vm.tracer != nil {
+		vm.trace(TracePush, op, nil)
+	}
+}
+
+// sreturn sets the value register and returns the op from the top frame
+func (vm *VM) sreturn(value *cell) opcode {
+	vm.global.value = value
+	vm.framePop()
+	return vm.global.op
+}
+
+// error0 returns the op to report an error message
+func (vm *VM) error0(msg string) opcode {
+	vm.global.args = mkpair(mkstring(msg, false), _NIL)
+	vm.global.signalled = nil
+	if vm.tracer != nil {
+		vm.trace(TraceError, opcInvalid, vm.global.args)
+	}
+	return opcError0
+}
+
+// sigerr returns the op to signal the error named by msg.
+// The irritants are the objects that caused it. They are not part of
+// the error value; they are only printed if the error is not handled.
+func (vm *VM) sigerr(msg string, irritants ...*cell) opcode {
+	return vm.signal(vm.intern(msg), vm.list(irritants...))
+}
+
+// goerror returns the op to signal an error returned by Go code.
+// The errors that the VM makes are named, like car-on-atom, and are
+// signalled as the symbol with that name. Any other error, such as one
+// from writing to a stream, is signalled as go-error with its text as
+// a string, since interning the text would add a symbol for each message.
+func (vm *VM) goerror(err error, irritants ...*cell) opcode {
+	if msg := err.Error(); iserrname(msg) {
+		return vm.sigerr(msg, irritants...)
+	}
+	return vm.sigerr("go-error", append([]*cell{mkstring(err.Error(), false)}, irritants...)...)
+}
+
+// iserrname returns true if the text is the name of an error,
+// which is lowercase letters, digits, and hyphens
+func iserrname(text string) bool {
+	for _, r := range text {
+		if !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return text != ""
+}
+
+// signal returns the op to deliver an error value to the dynamically
+// bound err function, as sigerr in pgdocs/bel.bel does. The value that
+// err returns becomes the value of the expression that failed.
+// If err is not dynamically bound, the error is reported at the top
+// level along with the position of the top level expression.
+func (vm *VM) signal(value, irritants *cell) opcode {
+	if vm.tracer != nil {
+		vm.trace(TraceError, opcInvalid, mkpair(value, irritants))
+	}
+	for a := vm.global.dynEnv; ispair(a); a = cdr(a) {
+		if b := car(a); car(b) == vm._ERR {
+			vm.global.code, vm.global.args = cdr(b), vm.list(value)
+			return opcApply
+		}
+	}
+	vm.global.signalled = &Error{Value: Value{value}, Irritants: Value{irritants}, Position: vm.global.position}
+	msg := value.String()
+	if pos := vm.global.position.String(); pos != "" {
+		msg = pos + ": " + msg
+	}
+	vm.global.args = mkpair(mkstring(msg, false), irritants)
+	return opcError0
+}
+
+// rderror returns the op to signal an error found by the reader
+func (vm *VM) rderror(tok *token, msg string) opcode {
+	vm.global.position = Position{Name: vm.global.rdr.name, Line: tok.line, Col: tok.col}
+	return vm.sigerr(msg)
+}
+
+// rdtoken reads the next token, skipping comments
+func (vm *VM) rdtoken() (err error) {
+	for {
+		if vm.global.currentToken, err = vm.global.rdr.nextToken(); err != nil {
+			return err
+		} else if vm.global.currentToken.k != tkCOMMENT {
+			return nil
+		}
+	}
+}
+
+// rdclose returns the list read, converting [...] into (fn (_) ...)
+func (vm *VM) rdclose(list *cell) *cell {
+	if vm.global.code == _TRUE {
+		return vm.list(vm.intern("fn"), vm.list(vm.intern("_")), list)
+	}
+	return list
+}
+
+// rdterminator returns the marker for the terminator of the list being read.
+// It is _TRUE for brackets and _NIL for parentheses.
+func rdterminator(tok *token) *cell {
+	if tok.text == "[" || tok.text == "]" {
+		return _TRUE
+	}
+	return _NIL
+}
+
+// mkforms returns the special forms.
+// They take precedence over any binding of the symbol.
+func (vm *VM) mkforms() map[*cell]opcode {
+	return map[*cell]opcode{
+		vm._QUOTE:  opcQuote,
+		vm._IF:     opcIf0,
+		vm._SET:    opcSet0,
+		vm._DEF:    opcDef,
+		vm._FN:     opcFn,
+		vm._DO:     opcDo0,
+		vm._MAC:    opcMac,
+		vm._MACRO:  opcMacro,
+		vm._DYN:    opcDyn0,
+		vm._ONERR:  opcOnerr0,
+		vm._SAFE:   opcSafe,
+		vm._WHERE:  opcWhere0,
+		vm._AFTER:  opcAfter0,
+		vm._BQUOTE: opcBquote,
+	}
+}
+
+// mkopprims returns the primitives that are implemented as op codes
+// because they have to evaluate Bel code.
+func (vm *VM) mkopprims() map[*cell]opcode {
+	return map[*cell]opcode{
+		vm._MACROEXPAND:  opcExpand,
+		vm._MACROEXPAND1: opcExpand,
+		vm._CCC:          opcCcc,
+		vm._ERR:          opcErr,
+		vm._LOAD:         opcLoad,
+		vm._READ:         opcReadPrim0,
+	}
+}
+
+// ismacro returns true if the cell is a macro, (lit mac clo)
+func (vm *VM) ismacro(a *cell) bool {
+	return ispair(a) && car(a) == vm._LIT && nth(a, 1) == vm._MAC
+}
+
+// macroOf returns the macro if the form is a call to one.
+// Otherwise, it returns nil.
+func (vm *VM) macroOf(form *cell) *cell {
+	if !ispair(form) || !vm.variable(car(form)) {
+		return nil
+	} else if _, ok := vm.forms[car(form)]; ok {
+		return nil
+	} else if b := vm.lookup(car(form)); b != nil && vm.ismacro(cdr(b)) {
+		return cdr(b)
+	}
+	return nil
+}
+
+// spread returns the arguments for apply, where the last argument is
+// a list of the remaining arguments.
+func (vm *VM) spread(args *cell) *cell {
+	if args == _NIL {
+		return _NIL
+	}
+	rev := vm.reverse(args, _NIL)
+	return vm.reverse(cdr(rev), car(rev))
+}
+
+// mkclosure returns a closure over env.
+// A body with more than one expression is wrapped in a do.
+func (vm *VM) mkclosure(env, parms, body *cell) *cell {
+	if ispair(body) && cdr(body) == _NIL {
+		body = car(body)
+	} else {
+		body = vm.cons(vm._DO, body)
+	}
+	return vm.list(vm._LIT, vm._CLO, env, parms, body)
+}
+
+// bqex returns an expression that builds the backquoted expression e,
+// as bqex in pgdocs/bel.bel does. If nothing in e is unquoted, change is
+// false and e can be used as it is. n is the depth of nested backquotes.
+// The expression calls join and append as literal primitives so that it
+// doesn't depend on their bindings.
+//
+// The prelude's bquote can't be used because it is written with macros
+// that are themselves written with backquote.
+func (vm *VM) bqex(e *cell, n int) (sub *cell, change bool, err error) {
+	if !ispair(e) {
+		return nil, false, nil
+	}
+	switch car(e) {
+	case vm._BQUOTE:
+		return vm.bqwrap(e, n+1)
+	case vm._COMMA:
+		if n == 0 {
+			return nth(e, 1), true, nil
+		}
+		return vm.bqwrap(e, n-1)
+	case vm._COMMAAT:
+		if n == 0 {
+			return nil, false, errors.New("comma-at-outside-list")
+		}
+		return vm.bqwrap(e, n-1)
+	}
+	rest, rchange, err := vm.bqex(cdr(e), n)
+	if err != nil {
+		return nil, false, err
+	} else if !rchange {
+		rest = vm.list(vm._QUOTE, cdr(e))
+	}
+	if a := car(e); n == 0 && ispair(a) && car(a) == vm._COMMAAT {
+		return vm.list(vm.list(vm._LIT, vm._PRIM, vm._APPEND), nth(a, 1), rest), true, nil
+	}
+	first, fchange, err := vm.bqex(car(e), n)
+	if err != nil {
+		return nil, false, err
+	} else if !fchange && !rchange {
+		return nil, false, nil
+	} else if !fchange {
+		first = vm.list(vm._QUOTE, car(e))
+	}
+	return vm.list(vm.list(vm._LIT, vm._PRIM, vm._JOIN), first, rest), true, nil
+}
+
+// bqwrap expands a nested backquote, comma, or comma-at at depth n
+func (vm *VM) bqwrap(e *cell, n int) (sub *cell, change bool, err error) {
+	inner, change, err := vm.bqex(nth(e, 1), n)
+	if err != nil || !change {
+		return nil, false, err
+	}
+	join := vm.list(vm._LIT, vm._PRIM, vm._JOIN)
+	return vm.list(join, vm.list(vm._QUOTE, car(e)), vm.list(join, inner, _NIL)), true, nil
+}
+
+// inwhere returns true if the expression being evaluated should return
+// the location of its value rather than the value itself.
+func (vm *VM) inwhere() bool {
+	f := vm.frames.top()
+	return f != nil && f.op == opcWhere1
+}
+
+// setloc assigns a value to a location, (pair a) or (pair d).
+// It returns false if the location is not valid.
+func (vm *VM) setloc(loc, value *cell) bool {
+	cell, which := car(loc), nth(loc, 1)
+	if !ispair(cell) {
+		return false
+	} else if which == vm._A {
+		setcar(cell, value)
+	} else if which == vm._D {
+		setcdr(cell, value)
+	} else {
+		return false
+	}
+	return true
+}
+
+// streamScanner returns the scanner for a stream.
+// It is created on first use and kept so that input it has buffered
+// is not lost between reads.
+func streamScanner(a *cell) *scanner {
+	st := &a._object._stream
+	if st.sc == nil {
+		st.sc = newScanner(st.name, st.r)
+	}
+	return st.sc
+}
+
+// pushStream makes the stream being loaded the current input
+func (vm *VM) pushStream(st *cell) {
+	vm.ins = append([]io.Reader{st._object._stream.r}, vm.ins...)
+	vm.scanners = append([]*scanner{streamScanner(st)}, vm.scanners...)
+	vm.loadReaders++
+}
+
+// syncReaders makes the inputs pushed by load match the loads in
+// progress, which are the streams in the opcLoad0 and opcLoad1 frames.
+// It is needed when frames are discarded without being popped, as
+// when a continuation is resumed or an error returns to the top level.
+// The scanner for each stream is kept with the stream, so a stream can
+// be popped and pushed again without losing input.
+func (vm *VM) syncReaders(frames []*frame) {
+	for ; vm.loadReaders > 0; vm.loadReaders-- {
+		vm.popReader()
+	}
+	for _, f := range frames {
+		if (f.op == opcLoad0 || f.op == opcLoad1) && isstream(f.args) {
+			vm.pushStream(f.args)
+		}
+	}
+}
+
+// loading returns the names of the files being loaded, innermost first.
+// The stream for each file is kept in the frames of the load.
+func (vm *VM) loading() []string {
+	var names []string
+	for i := len(vm.frames.stack) - 1; i >= 0; i-- {
+		if f := vm.frames.stack[i]; (f.op == opcLoad0 || f.op == opcLoad1) && isstream(f.args) {
+			names = append(names, f.args._object._stream.name)
+		}
+	}
+	return names
+}
+
+// loadStream returns a stream for the file named by a call to load.
+// A relative name is relative to the directory of the file that is
+// being loaded, if there is one, and to the working directory if not.
+// The name *stdin* is the console. No name can be loaded if the VM
+// was created WithoutFiles.
+func (vm *VM) loadStream(name string) (*cell, error) {
+	if vm.noFiles {
+		return nil, errors.New("no-files")
+	}
+	files := vm.loading()
+	if name == "*stdin*" {
+		for _, f := range files {
+			if f == name {
+				return nil, errors.New("load-cycle")
+			}
+		}
+		st := mkstreamr(name, os.Stdin)
+		for _, sc := range vm.scanners {
+			if sc.name == name {
+				// share the console's scanner so buffered input isn't lost
+				st._object._stream.sc = sc
+			}
+		}
+		return st, nil
+	}
+	if !filepath.IsAbs(name) && len(files) != 0 && files[0] != "*stdin*" {
+		name = filepath.Join(filepath.Dir(files[0]), name)
+	}
+	name = filepath.Clean(name)
+	abs, _ := filepath.Abs(name)
+	for _, f := range files {
+		if f, _ := filepath.Abs(f); f == abs {
+			return nil, errors.New("load-cycle")
+		}
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, errors.New("cannot-open")
+	}
+	return mkstreamr(name, bytes.NewReader(b)), nil
+}
+
+// nthlist returns the tail of the list that starts with its nth
+// element, or the atom that ends the list if it is shorter. It polls
+// on each pass, since the list may be circular. The error is from
+// exceeding a limit.
+func (vm *VM) nthlist(n *big.Int, xs *cell) (*cell, error) {
+	i := int64(math.MaxInt64)
+	if n.IsInt64() {
+		i = n.Int64()
+	}
+	for ; i > 1 && ispair(xs); i-- {
+		if err := vm.poll(); err != nil {
+			return nil, err
+		}
+		xs = cdr(xs)
+	}
+	return xs, nil
 }
 
-// framePush pushes a frame
-func (vm *VM) framePush(op opcode, args ...*cell) {
-	vm.frames.push(op, vm.global.currentEnv, args...)
+// unwound returns frames that evaluate the second expression of each
+// after that is unwound when the stack is replaced by another. An after
+// is unwound when its opcAfter1 frame is on the old stack but not the
+// new one. The frames are returned in the order they are to be pushed,
+// so the innermost after runs first.
+func unwound(from, to []*frame) []*frame {
+	i := 0
+	for i < len(from) && i < len(to) && from[i] == to[i] {
+		i++
+	}
+	var fs []*frame
+	for _, f := range from[i:] {
+		if f.op == opcAfter1 {
+			fs = append(fs, &frame{op: opcAfter3, env: f.env, dyn: f.dyn, args: _NIL, code: f.code})
+		}
+	}
+	return fs
 }
 
-var loops int
+// halting returns true if eval was called to evaluate a single form
+// rather than to run the top level.
+func (vm *VM) halting() bool {
+	return len(vm.frames.stack) != 0 && vm.frames.stack[0].op == opcHalt
+}
 
-func (vm *VM) eval(op opcode, args *cell) *cell {
-	fmt.Printf("\n%03d$ (eval (%s %s) %s)\n", loops, op, args, vm.global.env)
+// readForm reads the next expression from the current input.
+// It returns io.EOF when the input is exhausted.
+func (vm *VM) readForm() (*cell, error) {
+	vm.frames.reset()
+	vm.framePush(opcHalt, _NIL, _NIL)
+	return vm.eval(opcRead, _NIL)
+}
+
+// evalForm evaluates a single form in the global environment
+// and returns its value.
+func (vm *VM) evalForm(form *cell) (*cell, error) {
+	return vm.evalFormAt(form, Position{})
+}
+
+// evalFormAt evaluates a form that was read at the given position.
+// Errors that aren't handled are reported with the position.
+func (vm *VM) evalFormAt(form *cell, pos Position) (*cell, error) {
+	vm.frames.reset()
+	vm.global.currentEnv, vm.global.dynEnv = vm.global.env, _NIL
+	vm.global.position = pos
+	vm.framePush(opcHalt, _NIL, _NIL)
+	vm.global.code = form
+	return vm.eval(opcEval, _NIL)
+}
+
+func (vm *VM) eval(op opcode, args *cell) (*cell, error) {
+	// loads that an error or the end of the input interrupted are
+	// abandoned, so the caller gets its input back
+	defer vm.syncReaders(nil)
 
 	var err error
 	vm.global.args = args
@@ -51,25 +483,61 @@ func (vm *VM) eval(op opcode, args *cell) *cell {
 
 	for {
 		if err != nil {
-			fmt.Printf("eval: %+v\n", err)
-			return _NIL
+			return _NIL, err
 		}
 
-		loops = loops + 1
-		if loops > 50 {
-			panic("threshold exceeded")
+		if atomic.CompareAndSwapInt32(&vm.interrupted, 1, 0) {
+			op = vm.error0("interrupted")
+			continue
 		}
 
-		fmt.Printf("\n%03d> (%s %s)\n", loops, op, vm.global.args)
+		vm.steps++
+		if err := vm.exceeded(); err != nil {
+			if vm.halting() {
+				return _NIL, err
+			}
+			// report the error and return to the top level
+			op = vm.error0(err.Error())
+			continue
+		}
+		if vm.tracer != nil {
+			vm.trace(TraceDispatch, op, vm.global.args)
+		}
 
 		switch op {
 		case opcError0:
 			// args: (string ...)
 			if !isstring(car(vm.global.args)) {
-				vm.global.args = mkpair(mkstring("error: argument is not string"), _NIL)
+				vm.global.args = mkpair(mkstring("error: argument is not string", false), _NIL)
 				op = opcError0
 				continue
+			} else if fs := unwound(vm.frames.stack, nil); vm.global.signalled != nil && len(fs) != 0 {
+				// the afters that the error unwinds run before it is
+				// reported. their frames are dropped so they run once.
+				var stack []*frame
+				for _, f := range vm.frames.stack {
+					if f.op != opcAfter1 {
+						stack = append(stack, f)
+					}
+				}
+				stack = append(stack, &frame{op: opcError0, env: vm.global.currentEnv, dyn: vm.global.dynEnv, args: vm.global.args, code: _NIL})
+				vm.frames.stack = append(stack, fs...)
+				op = vm.sreturn(vm.global.value)
+				continue
+			} else if vm.halting() {
+				// there is no top level to return to, so the caller gets the error
+				if vm.global.signalled != nil {
+					err, vm.global.signalled = vm.global.signalled, nil
+					continue
+				}
+				msg := []string{asstring(car(vm.global.args))}
+				for a := cdr(vm.global.args); ispair(a); a = cdr(a) {
+					msg = append(msg, car(a).String())
+				}
+				err = errors.New(strings.Join(msg, " "))
+				continue
 			}
+			vm.global.signalled = nil
 			vm.pushWriter(vm.errs[0])
 			vm.puts("error: ")
 			vm.puts(asstring(car(vm.global.args)))
@@ -89,69 +557,855 @@ func (vm *VM) eval(op opcode, args *cell) *cell {
 			}
 			vm.puts(" ")
 			carArgs, cdrArgs := car(vm.global.args), cdr(vm.global.args)
-			vm.framePush(opcError1, cdrArgs)
+			vm.framePush(opcError1, cdrArgs, _NIL)
 			vm.global.args = carArgs
 			vm.global.printFlag = 1
+			vm.global.printer = newPrinter(carArgs)
 			op = opcP0List
 		case opcLoad:
 			// args: (filename) or (stream)
+			// the file or stream is pushed as the current input and read
+			// and evaluated by opcLoad0 and opcLoad1. when it is exhausted,
+			// the input is popped and load returns nil to its caller.
 			input, args := car(vm.global.args), cdr(vm.global.args)
-			if isstring(input) {
-				if asstring(input) == "*stdin*" {
-					panic(fmt.Sprintf("%s: interactive: not implemented", op))
-				}
-				a := mkpair(mkstring("load: filename: not implemented"), _NIL)
-				vm.global.args = a
-				op = opcError0
+			if args != _NIL {
+				op = vm.sigerr("overargs", vm.global.args)
 				continue
-			} else if isstream(input) {
-				if args != _NIL {
-					a := mkpair(mkstring("load: too many arguments"), _NIL)
-					vm.global.args = a
-					op = opcError0
+			}
+			var st *cell
+			if isstream(input) && input._object._stream.r != nil {
+				st = input
+			} else if isstring(input) {
+				var err error
+				if st, err = vm.loadStream(asstring(input)); err != nil {
+					op = vm.goerror(err, input)
 					continue
 				}
-				fmt.Printf("\nloading %s\n", input._object._stream.name)
-				vm.pushReader(input._object._stream.r)
-				op = opcTopLevel0
+			} else {
+				op = vm.sigerr("mistype", input)
 				continue
 			}
-			a := mkpair(mkstring("load: argument must be stream or string"), _NIL)
-			vm.global.args = a
-			op = opcError0
+			vm.pushStream(st)
+			vm.global.args = st
+			op = opcLoad0
 		case opcP0List:
-			panic(fmt.Sprintf("%s: not implemented", op))
+			// args: the object to print
+			a, p := vm.global.args, vm.global.printer
+			if !ispair(a) {
+				vm.puts(prsimple(a))
+				op = vm.sreturn(_TRUE)
+				continue
+			} else if p.labeled(a) {
+				// shared structure is printed once, then referred to by label
+				text, first := p.label(a)
+				vm.puts(text)
+				if !first {
+					op = vm.sreturn(_TRUE)
+					continue
+				} else if ischar(car(a)) && p.ustring(cdr(a)) {
+					vm.puts(prstring(asstring(a)))
+					op = vm.sreturn(_TRUE)
+					continue
+				}
+			} else if p.ustring(a) {
+				vm.puts(prstring(asstring(a)))
+				op = vm.sreturn(_TRUE)
+				continue
+			} else if prefix := p.abbrev(a); prefix != "" {
+				vm.puts(prefix)
+				vm.global.args = car(cdr(a))
+				continue
+			}
+			vm.puts("(")
+			vm.framePush(opcP1List, cdr(a), _NIL)
+			vm.global.args = car(a)
+			op = opcP0List
 		case opcP1List:
-			panic(fmt.Sprintf("%s: not implemented", op))
+			// args: the rest of the list being printed
+			a, p := vm.global.args, vm.global.printer
+			if a == _NIL {
+				vm.puts(")")
+				op = vm.sreturn(_TRUE)
+			} else if !ispair(a) || p.labeled(a) || p.ustring(a) {
+				// print the rest in dotted form and then close the list
+				vm.puts(" . ")
+				vm.framePush(opcP1List, _NIL, _NIL)
+				vm.global.args = a
+				op = opcP0List
+			} else {
+				vm.puts(" ")
+				vm.framePush(opcP1List, cdr(a), _NIL)
+				vm.global.args = car(a)
+				op = opcP0List
+			}
 		case opcRead:
-			if vm.global.currentToken, err = vm.scanner.nextToken(); err != nil {
-				fmt.Printf("read: %+v\n", err)
-				panic(fmt.Sprintf("op(%s): unhandled error", op))
+			// args: nil to read from the current input, or a stream
+			if isstream(vm.global.args) {
+				vm.global.rdr = streamScanner(vm.global.args)
+			} else {
+				vm.global.rdr = vm.scanners[0]
+			}
+			// labels for shared structure are local to a top level expression
+			vm.global.labels = map[string]*cell{}
+			if err := vm.rdtoken(); err != nil {
+				op = vm.error0(fmt.Sprintf("read: %v", err))
+				continue
+			}
+			// errors are reported with the position of the top level expression
+			if f := vm.frames.top(); f != nil && (f.op == opcTopLevel1 || f.op == opcHalt || f.op == opcLoad1) {
+				tok := vm.global.currentToken
+				vm.global.position = Position{Name: vm.global.rdr.name, Line: tok.line, Col: tok.col}
 			}
 			op = opcReadSExpr
 		case opcReadSExpr:
-			if vm.global.currentToken.k == tkEOF {
-				fmt.Printf("\n%s: found end-of-file\n", op)
-				return _NIL
+			tok := vm.global.currentToken
+			switch tok.k {
+			case tkEOF:
+				f := vm.frames.top()
+				if f != nil && f.op == opcReadPrim {
+					// read returns its eof argument
+					op = vm.sreturn(f.args)
+					continue
+				} else if f != nil && f.op == opcLoad1 {
+					// the file is exhausted, so load returns nil to its caller
+					vm.sreturn(_NIL)
+					op = vm.sreturn(_NIL)
+					vm.syncReaders(vm.frames.stack)
+					continue
+				} else if f != nil && f.op == opcHalt {
+					return _NIL, io.EOF
+				} else if f == nil || f.op != opcTopLevel1 {
+					op = vm.rderror(tok, "unterminated-expression")
+					continue
+				}
+				// the input is exhausted, so return to the caller
+				return _NIL, nil
+			case tkCOMMENT:
+				if err := vm.rdtoken(); err != nil {
+					op = vm.error0(fmt.Sprintf("read: %v", err))
+					continue
+				}
+			case tkLPAREN:
+				code := rdterminator(tok)
+				if err := vm.rdtoken(); err != nil {
+					op = vm.error0(fmt.Sprintf("read: %v", err))
+					continue
+				}
+				switch vm.global.currentToken.k {
+				case tkRPAREN:
+					if rdterminator(vm.global.currentToken) != code {
+						op = vm.rderror(vm.global.currentToken, "unexpected-terminator")
+						continue
+					}
+					vm.global.code = code
+					op = vm.sreturn(vm.rdclose(_NIL))
+				case tkDOT:
+					op = vm.rderror(vm.global.currentToken, "missing-car")
+				default:
+					vm.framePush(opcReadList, _NIL, code)
+					op = opcReadSExpr
+				}
+			case tkRPAREN:
+				op = vm.rderror(tok, "unexpected-terminator")
+			case tkDOT:
+				op = vm.rderror(tok, "unexpected-dot")
+			case tkATOM:
+				a, err := vm.rdatom(tok.text)
+				if err != nil {
+					op = vm.rderror(tok, err.Error())
+					continue
+				}
+				op = vm.sreturn(a)
+			case tkDQUOTE:
+				op = vm.sreturn(vm.chars(tok.text))
+			case tkQUOTE, tkBQUOTE, tkCOMMA, tkATMARK:
+				var wrapper *cell
+				switch tok.k {
+				case tkQUOTE:
+					wrapper = vm.intern("quote")
+				case tkBQUOTE:
+					wrapper = vm.intern("bquote")
+				case tkCOMMA:
+					wrapper = vm.intern("comma")
+				case tkATMARK:
+					wrapper = vm.intern("comma-at")
+				}
+				if err := vm.rdtoken(); err != nil {
+					op = vm.error0(fmt.Sprintf("read: %v", err))
+					continue
+				}
+				vm.framePush(opcReadWrap, _NIL, wrapper)
+				op = opcReadSExpr
+			case tkSHARP:
+				name := tok.text[1:]
+				if name == "" || name == "=" {
+					op = vm.rderror(tok, "unknown-label")
+				} else if name[len(name)-1] == '=' {
+					// create the pair before reading the target so that
+					// the target can refer to itself
+					target := vm.cons(_NIL, _NIL)
+					vm.global.labels[name[:len(name)-1]] = target
+					if err := vm.rdtoken(); err != nil {
+						op = vm.error0(fmt.Sprintf("read: %v", err))
+						continue
+					}
+					vm.framePush(opcReadLabel, target, _NIL)
+					op = opcReadSExpr
+				} else if target, ok := vm.global.labels[name]; ok {
+					op = vm.sreturn(target)
+				} else {
+					op = vm.rderror(tok, "unknown-label")
+				}
+			default:
+				op = vm.rderror(tok, fmt.Sprintf("unexpected %s", tok.k))
 			}
-			panic(fmt.Sprintf("%s: not implemented", op))
+		case opcReadList:
+			// args: elements read so far, in reverse order
+			// code: terminator for the list
+			vm.global.args = vm.cons(vm.global.value, vm.global.args)
+			if err := vm.rdtoken(); err != nil {
+				op = vm.error0(fmt.Sprintf("read: %v", err))
+				continue
+			}
+			switch tok := vm.global.currentToken; tok.k {
+			case tkEOF:
+				op = vm.rderror(tok, "unterminated-list")
+			case tkRPAREN:
+				if rdterminator(tok) != vm.global.code {
+					op = vm.rderror(tok, "unexpected-terminator")
+					continue
+				}
+				op = vm.sreturn(vm.rdclose(vm.reverse(vm.global.args, _NIL)))
+			case tkDOT:
+				if err := vm.rdtoken(); err != nil {
+					op = vm.error0(fmt.Sprintf("read: %v", err))
+					continue
+				}
+				vm.framePush(opcReadDot, vm.global.args, vm.global.code)
+				op = opcReadSExpr
+			default:
+				vm.framePush(opcReadList, vm.global.args, vm.global.code)
+				op = opcReadSExpr
+			}
+		case opcReadDot:
+			// args: elements read before the dot, in reverse order
+			// code: terminator for the list
+			if err := vm.rdtoken(); err != nil {
+				op = vm.error0(fmt.Sprintf("read: %v", err))
+				continue
+			}
+			switch tok := vm.global.currentToken; tok.k {
+			case tkEOF:
+				op = vm.rderror(tok, "unterminated-list")
+			case tkRPAREN:
+				if rdterminator(tok) != vm.global.code {
+					op = vm.rderror(tok, "unexpected-terminator")
+					continue
+				}
+				op = vm.sreturn(vm.rdclose(vm.reverse(vm.global.args, vm.global.value)))
+			default:
+				op = vm.rderror(tok, "duplicate-cdr")
+			}
+		case opcReadWrap:
+			// code: the symbol to wrap around the expression
+			op = vm.sreturn(vm.list(vm.global.code, vm.global.value))
+		case opcReadLabel:
+			// args: the pair created for the label
+			if !ispair(vm.global.value) {
+				op = vm.error0("read: bad-target")
+				continue
+			}
+			setcar(vm.global.args, car(vm.global.value))
+			setcdr(vm.global.args, cdr(vm.global.value))
+			op = vm.sreturn(vm.global.args)
 		case opcTopLevel0:
-			// flush the output stream
-			vm.puts("\n")
-			// clear any existing frames
+			// clear any existing frames, and the input of any loads
+			// that an error interrupted
 			vm.frames.reset()
+			vm.syncReaders(nil)
+			interactive := vm.interactive()
+			// flush the output stream
+			if interactive {
+				vm.puts("\n")
+			}
 			// reset the environment
-			vm.global.currentEnv = vm.global.env
+			vm.global.currentEnv, vm.global.dynEnv = vm.global.env, _NIL
 			// push two frames to run top level one and then to print the result
-			vm.frames.push(opcValuePrint, _NIL)
-			vm.frames.push(opcTopLevel1, _NIL)
+			vm.framePush(opcValuePrint, _NIL, _NIL)
+			vm.framePush(opcTopLevel1, _NIL, _NIL)
 			// display a prompt
-			vm.puts("bel> ")
+			if interactive {
+				vm.prompt()
+			}
+			// limits apply to each top level expression
+			vm.steps, vm.cells = 0, 0
 			// read in the next bit of input
 			op = opcRead
+		case opcTopLevel1:
+			// value: the expression read
+			vm.global.code = vm.global.value
+			op = opcEval
+		case opcEval:
+			// code: the expression to evaluate in the current environment
+			e := vm.global.code
+			if vm.literal(e) {
+				op = vm.sreturn(e)
+			} else if vm.variable(e) {
+				b := vm.lookup(e)
+				if f := vm.frames.top(); f != nil && f.op == opcWhere1 {
+					// the location of a variable is the cdr of its binding
+					if b == nil && f.code != _NIL {
+						vm.defglobal(e, _NIL)
+						b = vm.lookup(e)
+					} else if b == nil {
+						op = vm.sigerr("unbound", e)
+						continue
+					}
+					vm.sreturn(vm.list(b, vm._D))
+					op = opcWhere2
+					continue
+				} else if b == nil {
+					op = vm.sigerr("unbound", e)
+					continue
+				}
+				op = vm.sreturn(cdr(b))
+			} else if !proper(e) {
+				op = vm.sigerr("malformed", e)
+			} else if form, ok := vm.forms[car(e)]; ok {
+				op = form
+			} else {
+				// evaluate the operator and then the arguments
+				vm.framePush(opcE0Args, _NIL, e)
+				vm.global.code = car(e)
+			}
+		case opcE0Args:
+			// value: the operator
+			// code: the expression
+			if vm.ismacro(vm.global.value) {
+				// apply the macro to the unevaluated arguments and then
+				// evaluate the expansion in this environment
+				vm.framePush(opcMacEval, _NIL, _NIL)
+				vm.global.code, vm.global.args = nth(vm.global.value, 2), cdr(vm.global.code)
+				op = opcApply
+				continue
+			}
+			vm.global.args = _NIL
+			vm.global.code = cdr(vm.global.code)
+			op = opcE1Args
+		case opcE1Args:
+			// value: the operator or argument just evaluated
+			// args: the operator and arguments evaluated so far, in reverse order
+			// code: the arguments left to evaluate
+			vm.global.args = vm.cons(vm.global.value, vm.global.args)
+			if ispair(vm.global.code) {
+				vm.framePush(opcE1Args, vm.global.args, cdr(vm.global.code))
+				vm.global.code = car(vm.global.code)
+				op = opcEval
+				continue
+			}
+			list := vm.reverse(vm.global.args, _NIL)
+			vm.global.code, vm.global.args = car(list), cdr(list)
+			op = opcApply
+		case opcApply:
+			// code: the function
+			// args: the arguments
+			f := vm.global.code
+			if isnumber(f) {
+				// a number n applied to a list is its nth element
+				if !isint(f) || numr(f).Sign() <= 0 || !ispair(vm.global.args) {
+					op = vm.sigerr("mistype", f)
+					continue
+				}
+				xs, err := vm.nthlist(numr(f).Num(), car(vm.global.args))
+				if err != nil {
+					// programs can't catch these, as with the limits checked above
+					if vm.halting() {
+						return _NIL, err
+					}
+					op = vm.error0(err.Error())
+					continue
+				} else if ispair(xs) && vm.inwhere() {
+					vm.sreturn(vm.list(xs, vm._A))
+					op = opcWhere2
+					continue
+				} else if ispair(xs) {
+					op = vm.sreturn(car(xs))
+					continue
+				} else if xs == _NIL && !vm.inwhere() {
+					// like nth, running off the end of the list is nil
+					op = vm.sreturn(_NIL)
+					continue
+				}
+				op = vm.sigerr("mistype", vm.list(f, car(vm.global.args)))
+				continue
+			} else if f == vm._APPLY {
+				// (apply f a b xs) applies f to a, b, and the elements of xs
+				vm.global.code, vm.global.args = car(vm.global.args), vm.spread(cdr(vm.global.args))
+				continue
+			} else if !ispair(f) || car(f) != vm._LIT {
+				op = vm.sigerr("cannot-apply", f)
+				continue
+			}
+			switch car(cdr(f)) {
+			case vm._CLO:
+				// (lit clo env parms body)
+				// the body is evaluated without pushing a frame, so calls
+				// in tail position don't grow the frame stack.
+				env, parms, body := nth(f, 2), nth(f, 3), nth(f, 4)
+				vm.global.currentEnv = env
+				vm.global.code = body
+				vm.global.args = vm.list(vm.cons(parms, vm.global.args))
+				op = opcPass
+			case vm._CONT:
+				// (lit cont k) resumes the evaluation that k captured.
+				// the frames are copied so that k can be resumed again.
+				k := nth(f, 2)
+				if !iscontinuation(k) {
+					op = vm.sigerr("bad-cont", f)
+					continue
+				} else if vm.global.args == _NIL || cdr(vm.global.args) != _NIL {
+					op = vm.sigerr("wrong-no-args", vm.global.args)
+					continue
+				}
+				stack := append([]*frame(nil), k._object._cont.frames...)
+				if fs := unwound(vm.frames.stack, stack); len(fs) != 0 {
+					// the afters that k unwinds run before it resumes.
+					// opcAfter2 then returns the value to k.
+					stack = append(stack, &frame{op: opcAfter2, env: k._object._cont.env, dyn: k._object._cont.dyn, args: car(vm.global.args), code: _NIL})
+					stack = append(stack, fs...)
+				}
+				vm.frames.stack = stack
+				vm.global.currentEnv = k._object._cont.env
+				vm.global.dynEnv = k._object._cont.dyn
+				vm.syncReaders(vm.frames.stack)
+				op = vm.sreturn(car(vm.global.args))
+			case vm._MAC:
+				// (lit mac clo) applied to values, as in (apply or xs).
+				// the expansion is evaluated in the null environment.
+				vm.global.currentEnv = _NIL
+				vm.framePush(opcMacEval, _NIL, _NIL)
+				vm.global.code = nth(f, 2)
+			case vm._PRIM:
+				if xop, ok := vm.opprims[car(cdr(cdr(f)))]; ok {
+					// the op code is told which primitive it implements
+					vm.global.code, op = car(cdr(cdr(f))), xop
+					continue
+				}
+				if name := nth(f, 2); (name == vm._CAR || name == vm._CDR) && vm.inwhere() {
+					// the location of (car x) is (x a) and of (cdr x) is (x d)
+					loc := vm._A
+					if name == vm._CDR {
+						loc = vm._D
+					}
+					vm.sreturn(vm.list(car(vm.global.args), loc))
+					op = opcWhere2
+					continue
+				}
+				p, ok := vm.prims[car(cdr(cdr(f)))]
+				if !ok {
+					op = vm.sigerr("unknown-prim", f)
+					continue
+				}
+				v, err := vm.applyprim(p, vm.global.args)
+				var e *Error
+				if errors.As(err, &e) {
+					op = vm.signal(e.Value.cell(), e.Irritants.cell())
+					continue
+				} else if islimit(err) {
+					// programs can't catch these, as with the limits checked above
+					if vm.halting() {
+						return _NIL, err
+					}
+					op = vm.error0(err.Error())
+					continue
+				} else if err != nil {
+					op = vm.goerror(err, mkpair(car(cdr(cdr(f))), vm.global.args))
+					continue
+				}
+				op = vm.sreturn(v)
+			case vm._TAB, vm._ARR:
+				// tables and arrays are applied natively, in place of
+				// the virfns in the prelude
+				apply := vm.applytab
+				if car(cdr(f)) == vm._ARR {
+					apply = vm.applyarr
+				}
+				next, err := apply(f, vm.global.args)
+				if err != nil {
+					// programs can't catch these, as with the limits checked above
+					if vm.halting() {
+						return _NIL, err
+					}
+					op = vm.error0(err.Error())
+					continue
+				}
+				op = next
+			default:
+				op = vm.sigerr("unapplyable", f)
+			}
+		case opcPass:
+			// args: the parameters left to bind, as (pattern . argument) pairs
+			// code: the body of the closure
+			// currentEnv: the environment built so far, which is also the
+			// environment that defaults and type checks are evaluated in.
+			if vm.global.args == _NIL {
+				op = opcEval
+				continue
+			}
+			pat, arg, rest := car(car(vm.global.args)), cdr(car(vm.global.args)), cdr(vm.global.args)
+			if pat == _NIL {
+				if arg != _NIL {
+					op = vm.sigerr("overargs", arg)
+					continue
+				}
+				vm.global.args = rest
+			} else if vm.literal(pat) {
+				op = vm.sigerr("literal-parm", pat)
+			} else if vm.variable(pat) {
+				vm.global.currentEnv = vm.cons(vm.cons(pat, arg), vm.global.currentEnv)
+				vm.global.args = rest
+			} else if car(pat) == _TRUE {
+				// (t var f) binds var if (f 'arg) is true
+				vm.framePush(opcTypeCheck, vm.global.args, vm.global.code)
+				vm.global.code = vm.list(nth(pat, 2), vm.list(vm._QUOTE, arg))
+				op = opcEval
+			} else if car(pat) == vm._O {
+				// (o var default) has an argument, so the default is not used
+				vm.global.args = vm.cons(vm.cons(nth(pat, 1), arg), rest)
+			} else if arg == _NIL {
+				// the arguments ran out before the parameters did
+				p := car(pat)
+				if !ispair(p) || car(p) != vm._O {
+					op = vm.sigerr("underargs", pat)
+					continue
+				}
+				vm.framePush(opcPassDefault, vm.global.args, vm.global.code)
+				vm.global.code = nth(p, 2)
+				op = opcEval
+			} else if !ispair(arg) {
+				op = vm.sigerr("atom-arg", arg)
+			} else {
+				// destructure (p . ps) against (a . as)
+				vm.global.args = vm.cons(vm.cons(car(pat), car(arg)), vm.cons(vm.cons(cdr(pat), cdr(arg)), rest))
+			}
+		case opcTypeCheck:
+			// value: the result of the type check
+			// args: the parameters left to bind, starting with (t var f)
+			pat, arg, rest := car(car(vm.global.args)), cdr(car(vm.global.args)), cdr(vm.global.args)
+			if vm.global.value == _NIL {
+				op = vm.sigerr("mistype", vm.list(nth(pat, 2), arg))
+				continue
+			}
+			vm.global.args = vm.cons(vm.cons(nth(pat, 1), arg), rest)
+			op = opcPass
+		case opcPassDefault:
+			// value: the default for the optional parameter
+			// args: the parameters left to bind, starting with ((o var default) . ps)
+			pat, rest := car(car(vm.global.args)), cdr(vm.global.args)
+			vm.global.args = vm.cons(vm.cons(nth(car(pat), 1), vm.global.value), vm.cons(vm.cons(cdr(pat), _NIL), rest))
+			op = opcPass
+		case opcFn:
+			// code: (fn parms . body)
+			op = vm.sreturn(vm.mkclosure(vm.global.currentEnv, nth(vm.global.code, 1), cdr(cdr(vm.global.code))))
+		case opcDo0:
+			// code: (do . exprs)
+			vm.global.code = cdr(vm.global.code)
+			op = opcDo1
+		case opcDo1:
+			// code: the expressions left to evaluate.
+			// the last one is evaluated in tail position.
+			if vm.global.code == _NIL {
+				op = vm.sreturn(_NIL)
+				continue
+			} else if cdr(vm.global.code) != _NIL {
+				vm.framePush(opcDo1, _NIL, cdr(vm.global.code))
+			}
+			vm.global.code = car(vm.global.code)
+			op = opcEval
+		case opcMac:
+			// code: (mac name parms . body)
+			name := nth(vm.global.code, 1)
+			if !vm.variable(name) {
+				op = vm.sigerr("cannot-set", name)
+				continue
+			}
+			m := vm.list(vm._LIT, vm._MAC, vm.mkclosure(vm.global.currentEnv, nth(vm.global.code, 2), cdr(cdr(cdr(vm.global.code)))))
+			vm.assign(name, m)
+			op = vm.sreturn(m)
+		case opcMacro:
+			// code: (macro parms . body)
+			op = vm.sreturn(vm.list(vm._LIT, vm._MAC, vm.mkclosure(vm.global.currentEnv, nth(vm.global.code, 1), cdr(cdr(vm.global.code)))))
+		case opcMacEval:
+			// value: the expansion of a macro call
+			vm.global.code = vm.global.value
+			op = opcEval
+		case opcExpand:
+			// args: (form)
+			// code: the symbol for the primitive, macroexpand or macroexpand-1
+			form := car(vm.global.args)
+			m := vm.macroOf(form)
+			if m == nil {
+				op = vm.sreturn(form)
+				continue
+			} else if vm.global.code == vm._MACROEXPAND {
+				vm.framePush(opcExpand1, _NIL, vm.global.code)
+			}
+			vm.global.code, vm.global.args = nth(m, 2), cdr(form)
+			op = opcApply
+		case opcExpand1:
+			// value: the expansion
+			// code: the symbol for the primitive
+			vm.global.args = vm.list(vm.global.value)
+			op = opcExpand
+		case opcCcc:
+			// args: (f)
+			// the frame stack is the rest of the computation, so a snapshot
+			// of it and the environment is all a continuation needs.
+			k := vm.list(vm._LIT, vm._CONT, mkcontinuation(vm.frames.stack, vm.global.currentEnv, vm.global.dynEnv))
+			vm.global.code, vm.global.args = car(vm.global.args), vm.list(k)
+			op = opcApply
+		case opcDyn0:
+			// code: (dyn v e1 e2)
+			if v := nth(vm.global.code, 1); !vm.variable(v) {
+				op = vm.sigerr("cannot-bind", v)
+				continue
+			}
+			vm.framePush(opcDyn1, _NIL, vm.global.code)
+			vm.global.code = nth(vm.global.code, 2)
+			op = opcEval
+		case opcDyn1:
+			// value: the value of e1
+			// code: (dyn v e1 e2)
+			// e2 is evaluated without pushing a frame. the frame it returns
+			// to was pushed before the binding, so popping it unbinds v.
+			vm.global.dynEnv = vm.cons(vm.cons(nth(vm.global.code, 1), vm.global.value), vm.global.dynEnv)
+			vm.global.code = nth(vm.global.code, 3)
+			op = opcEval
+		case opcErr:
+			// args: (value . irritants)
+			op = vm.signal(car(vm.global.args), cdr(vm.global.args))
+		case opcOnerr0:
+			// code: (onerr e1 e2)
+			// e2 is evaluated with err bound to a handler that returns a
+			// unique mark to onerr1 through a continuation. onerr1 then
+			// evaluates e1 in place of e2.
+			mark := vm.cons(_NIL, _NIL)
+			vm.framePush(opcOnerr1, mark, vm.global.code)
+			k, c := vm.cons(vm.vmark, _NIL), vm.cons(vm.vmark, _NIL)
+			env := vm.list(vm.cons(k, vm.list(vm._LIT, vm._CONT, mkcontinuation(vm.frames.stack, vm.global.currentEnv, vm.global.dynEnv))))
+			handler := vm.mkclosure(env, vm.list(c), vm.list(vm.list(k, vm.list(vm._QUOTE, mark))))
+			vm.global.dynEnv = vm.cons(vm.cons(vm._ERR, handler), vm.global.dynEnv)
+			vm.global.code = nth(vm.global.code, 2)
+			op = opcEval
+		case opcOnerr1:
+			// value: the value of e2, or the mark if it signalled an error
+			// args: the mark
+			// code: (onerr e1 e2)
+			if vm.global.value != vm.global.args {
+				op = vm.sreturn(vm.global.value)
+				continue
+			}
+			vm.global.code = nth(vm.global.code, 1)
+			op = opcEval
+		case opcSafe:
+			// code: (safe e), which is (onerr nil e)
+			vm.global.code = vm.list(vm._ONERR, _NIL, nth(vm.global.code, 1))
+			op = opcOnerr0
+		case opcBquote:
+			// code: (bquote e)
+			e := nth(vm.global.code, 1)
+			sub, change, err := vm.bqex(e, 0)
+			if err != nil {
+				op = vm.goerror(err, e)
+				continue
+			} else if !change {
+				op = vm.sreturn(e)
+				continue
+			}
+			vm.global.code = sub
+			op = opcEval
+		case opcReadPrim0:
+			// args: ((o s) (o base 10) (o eof))
+			// the source is nil for the current input, a stream,
+			// or a string or list of strings.
+			src, eof := car(vm.global.args), nth(vm.global.args, 2)
+			if src != _NIL && !isstream(src) {
+				var sb strings.Builder
+				if isstring(src) {
+					sb.WriteString(asstring(src))
+				} else {
+					for a := src; ispair(a); a = cdr(a) {
+						if !isstring(car(a)) {
+							break
+						}
+						sb.WriteString(asstring(car(a)))
+					}
+				}
+				src = mkstreamr("string", strings.NewReader(sb.String()))
+			}
+			if b := nth(vm.global.args, 1); b != _NIL && !(isint(b) && numr(b).Cmp(big.NewRat(10, 1)) == 0) {
+				op = vm.sigerr("bad-base", b)
+				continue
+			}
+			vm.framePush(opcReadPrim, eof, _NIL)
+			vm.global.args = src
+			op = opcRead
+		case opcLoad0:
+			// args: the stream being loaded, which is the current input
+			vm.framePush(opcLoad1, vm.global.args, _NIL)
+			vm.global.args = _NIL
+			op = opcRead
+		case opcLoad1:
+			// value: the expression read
+			// args: the stream being loaded
+			// the expression is evaluated in the global environment
+			vm.framePush(opcLoad0, vm.global.args, _NIL)
+			vm.global.currentEnv = vm.global.env
+			vm.global.code = vm.global.value
+			op = opcEval
+		case opcHalt:
+			return vm.global.value, nil
+		case opcQuote:
+			// code: (quote e)
+			op = vm.sreturn(car(cdr(vm.global.code)))
+		case opcIf0:
+			// code: (if . clauses)
+			vm.global.code = cdr(vm.global.code)
+			op = opcIf1
+		case opcIf1:
+			// code: the clauses left, alternating tests and branches.
+			// a final clause without a branch is the else.
+			if vm.global.code == _NIL {
+				op = vm.sreturn(_NIL)
+			} else if cdr(vm.global.code) == _NIL {
+				vm.global.code = car(vm.global.code)
+				op = opcEval
+			} else {
+				vm.framePush(opcIf2, _NIL, cdr(vm.global.code))
+				vm.global.code = car(vm.global.code)
+				op = opcEval
+			}
+		case opcIf2:
+			// value: the value of the test
+			// code: the branch for the test followed by the remaining clauses
+			if vm.global.value != _NIL {
+				vm.global.code = car(vm.global.code)
+				op = opcEval
+			} else {
+				vm.global.code = cdr(vm.global.code)
+				op = opcIf1
+			}
+		case opcSet0:
+			// code: (set . pairs)
+			vm.global.code = cdr(vm.global.code)
+			vm.global.value = _NIL
+			op = opcSet1
+		case opcSet1:
+			// value: the value of the last assignment
+			// code: the places and expressions left to assign
+			if vm.global.code == _NIL {
+				op = vm.sreturn(vm.global.value)
+				continue
+			} else if p := car(vm.global.code); !vm.variable(p) && !ispair(p) {
+				op = vm.sigerr("cannot-set", p)
+				continue
+			} else if cdr(vm.global.code) == _NIL {
+				// the expression for the last place defaults to t
+				vm.global.value = _TRUE
+				op = opcSet2
+				continue
+			}
+			vm.framePush(opcSet2, _NIL, vm.global.code)
+			vm.global.code = car(cdr(vm.global.code))
+			op = opcEval
+		case opcSet2:
+			// value: the value to assign
+			// code: the place followed by the remaining pairs
+			if p := car(vm.global.code); ispair(p) && !vm.variable(p) {
+				// find the location of the place and then assign to it
+				vm.framePush(opcSet3, vm.global.value, vm.global.code)
+				// like (where place t), so a place that expands to an
+				// unbound variable creates a global
+				vm.framePush(opcWhere1, _NIL, _TRUE)
+				vm.global.code = p
+				op = opcEval
+				continue
+			}
+			vm.assign(car(vm.global.code), vm.global.value)
+			vm.global.code = cdr(cdr(vm.global.code))
+			op = opcSet1
+		case opcSet3:
+			// value: the location of the place, (pair a) or (pair d)
+			// args: the value to assign
+			// code: the place followed by the remaining pairs
+			if !vm.setloc(vm.global.value, vm.global.args) {
+				op = vm.sigerr("bad-place", car(vm.global.code))
+				continue
+			}
+			vm.global.value = vm.global.args
+			vm.global.code = cdr(cdr(vm.global.code))
+			op = opcSet1
+		case opcWhere0:
+			// code: (where e (o new))
+			// new means that an unbound variable gets a global binding
+			vm.framePush(opcWhere1, _NIL, nth(vm.global.code, 2))
+			vm.global.code = nth(vm.global.code, 1)
+			op = opcEval
+		case opcWhere1:
+			// the expression returned a value instead of a location
+			op = vm.sigerr("unfindable")
+		case opcWhere2:
+			// value: the location found for the where at the top of the stack
+			op = vm.sreturn(vm.global.value)
+		case opcAfter0:
+			// code: (after e1 e2)
+			// the opcAfter1 frame protects e2. if a continuation or an
+			// error unwinds the stack past it, e2 is evaluated by opcAfter3.
+			vm.framePush(opcAfter1, _NIL, vm.global.code)
+			vm.global.code = nth(vm.global.code, 1)
+			op = opcEval
+		case opcAfter1:
+			// value: the value of e1
+			// code: (after e1 e2)
+			vm.framePush(opcAfter2, vm.global.value, _NIL)
+			vm.global.code = nth(vm.global.code, 2)
+			op = opcEval
+		case opcAfter2:
+			// args: the value of e1
+			op = vm.sreturn(vm.global.args)
+		case opcAfter3:
+			// code: (after e1 e2)
+			// e2 is evaluated for its effect. the frame below ignores
+			// its value, or is opcAfter2 or opcError0 to finish the unwinding.
+			vm.global.code = nth(vm.global.code, 2)
+			op = opcEval
+		case opcReadPrim:
+			// value: the expression read
+			op = vm.sreturn(vm.global.value)
+		case opcDef:
+			// code: (def name parms . body)
+			name, parms, body := car(cdr(vm.global.code)), car(cdr(cdr(vm.global.code))), cdr(cdr(cdr(vm.global.code)))
+			if !vm.variable(name) {
+				op = vm.sigerr("cannot-set", name)
+				continue
+			}
+			clo := vm.mkclosure(vm.global.currentEnv, parms, body)
+			vm.assign(name, clo)
+			op = vm.sreturn(clo)
+		case opcValuePrint:
+			vm.global.values = append(vm.global.values, vm.global.value)
+			if !vm.interactive() {
+				op = opcTopLevel0
+				continue
+			}
+			// print the value and then return to the top level
+			vm.global.printFlag = 1
+			vm.global.printer = newPrinter(vm.global.value)
+			vm.global.args = vm.global.value
+			vm.framePush(opcTopLevel0, _NIL, _NIL)
+			op = opcP0List
 		default:
 			panic(fmt.Sprintf("%s: not implemented", op))
 		}
 	}
-	return _NIL
 }
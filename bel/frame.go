@@ -31,7 +31,8 @@ type frameStack struct {
 type frame struct {
 	op   opcode
 	env  *cell
-	args []*cell
+	dyn  *cell
+	args *cell
 	code *cell
 }
 
@@ -44,13 +45,16 @@ func (fs *frameStack) pop() *frame {
 	return f
 }
 
-func (fs *frameStack) push(op opcode, env *cell, args ...*cell) {
-	f := &frame{op: op, env: env}
-	for _, arg := range args {
-		f.args = append(f.args, arg)
-	}
+func (fs *frameStack) push(op opcode, env, dyn, args, code *cell) {
+	fs.stack = append(fs.stack, &frame{op: op, env: env, dyn: dyn, args: args, code: code})
+}
 
-	fs.stack = append(fs.stack, f)
+// top returns the most recently pushed frame, or nil if the stack is empty
+func (fs *frameStack) top() *frame {
+	if len(fs.stack) == 0 {
+		return nil
+	}
+	return fs.stack[len(fs.stack)-1]
 }
 
 func (fs *frameStack) reset() {
@@ -60,6 +60,11 @@ func IsPair(a *cell) bool {
 	return ispair(a)
 }
 
+// IsSymbol is a predicate returning true if the cell is a symbol
+func IsSymbol(a *cell) bool {
+	return issymbol(a)
+}
+
 // IsString is a predicate returning true if the cell is a string
 func IsString(a *cell) bool {
 	return isstring(a)
@@ -70,7 +75,21 @@ func MkPair(a, b *cell) *cell {
 	return mkpair(a, b)
 }
 
-// MkString creates a new STRING cell
+// MkString creates a new Bel string, which is a list of CHAR cells
 func MkString(s string) *cell {
-	return mkstring(s)
+	return mkstring(s, true)
+}
+
+// MkSymbol returns the SYMBOL with the given name.
+// Symbols are interned by the VM, so the same name always returns the same cell.
+func (vm *VM) MkSymbol(name string) *cell {
+	return vm.intern(name)
+}
+
+// SymbolName returns the name of a SYMBOL
+func SymbolName(a *cell) string {
+	if !IsSymbol(a) {
+		panic("cell:SymbolName")
+	}
+	return symbolName(a)
 }
@@ -0,0 +1,343 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSON is converted to Bel as follows:
+//
+//	object   a table, (lit tab ("key" . value) ...), with the pairs in
+//	         the order of the keys in the object, or an alist if the
+//	         mode is alist
+//	array    a list
+//	string   a string
+//	number   a number, which is exact, so 0.1 is 1/10 and big integers
+//	         keep every digit
+//	true     t
+//	false    the symbol false
+//	null     the symbol null
+//
+// Since nil is both the empty list and the empty string, [] and "" are
+// both read as nil, and nil is written as [].
+
+// jsonError returns the error that a json primitive signals.
+// Errors from exceeding a limit stop the evaluation instead.
+func (vm *VM) jsonError(err error) error {
+	if islimit(err) {
+		return err
+	}
+	return &Error{Value: Value{vm.intern("bad-json")}, Irritants: List(String(err.Error()))}
+}
+
+// jsonDecoder returns the decoder for reading JSON from a source,
+// which is a stream, a string, or nil for ins. If ins is nil too,
+// the source is the current input.
+// The decoders for streams and inputs belong to their scanners, so
+// they are released along with them.
+func (vm *VM) jsonDecoder(s *cell) (*json.Decoder, error) {
+	if s == _NIL {
+		s = vm.streamValue(vm._INS)
+	}
+	if s == _NIL {
+		return vm.scanners[0].jsonDecoder(), nil
+	} else if isstream(s) && s._object._stream.r != nil {
+		return streamScanner(s).jsonDecoder(), nil
+	} else if isstring(s) {
+		dec := json.NewDecoder(strings.NewReader(asstring(s)))
+		dec.UseNumber()
+		return dec, nil
+	}
+	return nil, errors.New("mistype")
+}
+
+// primJSONRead implements (json-read (o s) (o eof) (o mode)), which
+// reads the next JSON value from s and returns it, or returns eof if
+// there are no more values. The mode alist reads objects as alists.
+func primJSONRead(vm *VM, args []*cell) (*cell, error) {
+	dec, err := vm.jsonDecoder(args[0])
+	if err != nil {
+		return nil, err
+	}
+	alist := args[2] == vm.intern("alist")
+	v, err := vm.jsonValue(dec, alist)
+	if err == io.EOF {
+		return args[1], nil
+	} else if err != nil {
+		return nil, vm.jsonError(err)
+	}
+	return v, nil
+}
+
+// jsonValue reads a value with the decoder's tokens so that the keys
+// of objects stay in order and numbers stay exact
+func (vm *VM) jsonValue(dec *json.Decoder, alist bool) (*cell, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		var elts []*cell
+		for dec.More() {
+			if err := vm.poll(); err != nil {
+				return nil, err
+			}
+			var key *cell
+			if t == '{' {
+				k, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key = vm.chars(k.(string))
+			}
+			v, err := vm.jsonValue(dec, alist)
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			} else if err != nil {
+				return nil, err
+			}
+			if key != nil {
+				v = vm.cons(key, v)
+			}
+			elts = append(elts, v)
+		}
+		if _, err := dec.Token(); err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+		list := vm.list(elts...)
+		if t == '{' && !alist {
+			list = vm.cons(vm._LIT, vm.cons(vm.intern("tab"), list))
+		}
+		return list, nil
+	case string:
+		return vm.chars(t), nil
+	case json.Number:
+		r, ok := new(big.Rat).SetString(string(t))
+		if !ok {
+			return nil, errors.New("invalid number " + string(t))
+		}
+		return mknumber(r, rzero), nil
+	case bool:
+		if t {
+			return _TRUE, nil
+		}
+		return vm.intern("false"), nil
+	case nil:
+		return vm.intern("null"), nil
+	}
+	return nil, errors.New("unexpected token")
+}
+
+// primJSONWrite implements (json-write x (o s) (o mode)), which writes
+// x to s as JSON and returns x. The keys of a table are written in
+// sorted order unless the mode is ordered, which writes them in the
+// order of the table's pairs. The mode alist also writes a list whose
+// elements are all pairs with string or symbol keys as an object, with
+// the keys in order, so that what json-read reads in that mode can be
+// written back.
+func primJSONWrite(vm *VM, args []*cell) (*cell, error) {
+	w, err := vm.output(args[1])
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := vm.jsonWrite(&buf, args[0], args[2], map[*cell]bool{}); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return args[0], nil
+}
+
+// jsonWrite writes the JSON for x to buf in the mode, which is nil,
+// ordered, or alist. The path holds the pairs that are being written,
+// so that a value that contains itself signals cyclic rather than
+// recursing until the stack overflows.
+func (vm *VM) jsonWrite(buf *bytes.Buffer, x *cell, mode *cell, path map[*cell]bool) error {
+	if ispair(x) {
+		if path[x] {
+			return &Error{Value: Value{vm.intern("cyclic")}, Irritants: List(Value{x})}
+		} else if err := vm.poll(); err != nil {
+			return err
+		}
+		path[x] = true
+		defer delete(path, x)
+	}
+	switch {
+	case x == _NIL:
+		buf.WriteString("[]")
+	case x == _TRUE:
+		buf.WriteString("true")
+	case x == vm.intern("false"):
+		buf.WriteString("false")
+	case x == vm.intern("null"):
+		buf.WriteString("null")
+	case issymbol(x):
+		return jsonString(buf, symbolName(x))
+	case ischar(x):
+		return jsonString(buf, string(aschar(x)))
+	case isstring(x):
+		return jsonString(buf, asstring(x))
+	case isnumber(x):
+		if !isreal(x) {
+			return &Error{Value: Value{vm.intern("mistype")}, Irritants: List(Value{x})}
+		}
+		buf.WriteString(jsonNumber(numr(x)))
+	case car(x) == vm._LIT && nth(x, 1) == vm.intern("tab"):
+		return vm.jsonObject(buf, cdr(cdr(x)), mode, mode != vm.intern("ordered"), path)
+	case mode == vm.intern("alist") && isalist(x):
+		return vm.jsonObject(buf, x, mode, false, path)
+	case proper(x):
+		buf.WriteByte('[')
+		for a := x; ispair(a); a = cdr(a) {
+			if a != x {
+				buf.WriteByte(',')
+			}
+			if err := vm.jsonWrite(buf, car(a), mode, path); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		return &Error{Value: Value{vm.intern("mistype")}, Irritants: List(Value{x})}
+	}
+	return nil
+}
+
+// jsonObject writes the pairs of a table or alist to buf as an object,
+// sorting them by key if sorted is true
+func (vm *VM) jsonObject(buf *bytes.Buffer, pairs *cell, mode *cell, sorted bool, path map[*cell]bool) error {
+	type kv struct {
+		key string
+		val *cell
+	}
+	if !proper(pairs) {
+		return &Error{Value: Value{vm.intern("mistype")}, Irritants: List(Value{pairs})}
+	}
+	var kvs []kv
+	for a := pairs; ispair(a); a = cdr(a) {
+		p := car(a)
+		if !ispair(p) {
+			return &Error{Value: Value{vm.intern("mistype")}, Irritants: List(Value{p})}
+		}
+		var key string
+		if k := car(p); isnumber(k) && isreal(k) {
+			key = jsonNumber(numr(k))
+		} else if issymbol(k) {
+			key = symbolName(k)
+		} else if k != _NIL && isstring(k) {
+			key = asstring(k)
+		} else {
+			return &Error{Value: Value{vm.intern("mistype")}, Irritants: List(Value{k})}
+		}
+		kvs = append(kvs, kv{key, cdr(p)})
+	}
+	if sorted {
+		sort.SliceStable(kvs, func(i, j int) bool { return kvs[i].key < kvs[j].key })
+	}
+	buf.WriteByte('{')
+	for i, kv := range kvs {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		jsonString(buf, kv.key)
+		buf.WriteByte(':')
+		if err := vm.jsonWrite(buf, kv.val, mode, path); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// isalist returns true if x is a proper list whose elements are all
+// pairs with a string or symbol for a key. Strings are lists too, but
+// their elements are characters, so they are not alists.
+func isalist(x *cell) bool {
+	if !proper(x) {
+		return false
+	}
+	for a := x; ispair(a); a = cdr(a) {
+		p := car(a)
+		if !ispair(p) {
+			return false
+		} else if k := car(p); k == _NIL || !(issymbol(k) || isstring(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonString writes s as a JSON string
+func jsonString(buf *bytes.Buffer, s string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+// jsonNumber returns the JSON text for a rational number.
+// Integers and numbers with a finite decimal expansion are exact.
+// Others, like 1/3, are written as the nearest float64.
+func jsonNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	// the expansion is finite if the denominator has no factors but 2 and 5,
+	// and it needs as many digits as the larger number of those factors
+	d, twos, fives := new(big.Int).Set(r.Denom()), 0, 0
+	for d.Bit(0) == 0 {
+		d.Rsh(d, 1)
+		twos++
+	}
+	for five, q, m := big.NewInt(5), new(big.Int), new(big.Int); ; fives++ {
+		if q.QuoRem(d, five, m); m.Sign() != 0 {
+			break
+		}
+		d.Set(q)
+	}
+	if d.IsInt64() && d.Int64() == 1 {
+		if fives > twos {
+			twos = fives
+		}
+		return r.FloatString(twos)
+	}
+	f, _ := r.Float64()
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
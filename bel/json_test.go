@@ -0,0 +1,141 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	vm := NewVM(nil, WithoutPrelude(), WithIO(strings.NewReader(""), out, ioutil.Discard))
+	for _, tc := range []struct {
+		input  string
+		expect string // the value of the input
+		output string // what the input wrote
+	}{
+		// big integers keep every digit and decimals are exact
+		{`(json-read "123456789012345678901234567890")`, "123456789012345678901234567890", ""},
+		{`(json-write (json-read "[123456789012345678901234567890, 0.1, -2.5e3]"))`, "(123456789012345678901234567890 1/10 -2500)", "[123456789012345678901234567890,0.1,-2500]"},
+		{`(json-write 1/3)`, "1/3", "0.3333333333333333"},
+		// null and false are symbols, and true is t
+		{`(json-read "[null, false, true]")`, "(null false t)", ""},
+		{`(json-write '(null false t nil))`, "(null false t nil)", "[null,false,true,[]]"},
+		// objects are tables with the keys in order
+		{`(json-read "{\"b\":1,\"a\":{\"c\":null}}")`, `(lit tab ("b" . 1) ("a" lit tab ("c" . null)))`, ""},
+		{`(json-write (json-read "{\"b\":1,\"a\":2}"))`, `(lit tab ("b" . 1) ("a" . 2))`, `{"a":2,"b":1}`},
+		{`(json-write (json-read "{\"b\":1,\"a\":2}") nil 'ordered)`, `(lit tab ("b" . 1) ("a" . 2))`, `{"b":1,"a":2}`},
+		// or alists, which the alist mode writes back in order
+		{`(json-read "{\"b\":1,\"a\":[\"x\"]}" nil 'alist)`, `(("b" . 1) ("a" "x"))`, ""},
+		{`(json-write (json-read "{\"b\":1,\"a\":[\"x\"]}" nil 'alist) nil 'alist)`, `(("b" . 1) ("a" "x"))`, `{"b":1,"a":["x"]}`},
+		{`(json-write (json-read "[{\"b\":{\"c\":1}},\"s\",[]]" nil 'alist) nil 'alist)`, `((("b" ("c" . 1))) "s" nil)`, `[{"b":{"c":1}},"s",[]]`},
+		{`(json-write '((a . 1)) nil 'alist)`, `((a . 1))`, `{"a":1}`},
+		// strings aren't alists
+		{`(json-write '("ab" "cd") nil 'alist)`, `("ab" "cd")`, `["ab","cd"]`},
+		// writing to a queue
+		{`((fn (q) (json-write '(1 "a") q) (car q)) (join nil nil))`, `"[1,\"a\"]"`, ""},
+		{`(json-read "" 'done)`, "done", ""},
+		// shared structure is written once for each time it occurs
+		{`(json-write '(#1=(1) #1))`, "(#1=(1) #1)", "[[1],[1]]"},
+	} {
+		out.Reset()
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+			continue
+		}
+		if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+		if got := out.String(); got != tc.output {
+			t.Errorf("%s: output: expected %s: got %s", tc.input, tc.output, got)
+		}
+	}
+
+	for _, input := range []string{
+		`(json-read "[1,")`,
+		`(json-read "{\"a\" 1}")`,
+		`(json-write 1+2i)`,
+		`(json-write '(1 . 2))`,
+		`(json-write '((1 . 2)) nil 'alist)`,
+		`(json-read 'a)`,
+	} {
+		if _, err := vm.Eval(context.Background(), input); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+
+	// a value that contains itself can't be written
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(json-write '#1=(1 #1))`, "cyclic"},
+		{`(json-write '(1 #1=(2 #1)))`, "cyclic"},
+		{`(json-write '#1=(lit tab (a . #1)))`, "cyclic"},
+		{`(json-write '#1=((a . #1)) nil 'alist)`, "cyclic"},
+		{`(json-write '#1=(1 . #1))`, "mistype"},
+		{`(json-write '(lit tab . #1=((a . 1) . #1)))`, "mistype"},
+	} {
+		out.Reset()
+		_, err := vm.Eval(context.Background(), tc.input)
+		if e, ok := err.(*Error); !ok || e.Value.String() != tc.expect {
+			t.Errorf("%s: expected %s: got %v", tc.input, tc.expect, err)
+		} else if out.Len() != 0 {
+			t.Errorf("%s: expected no output: got %q", tc.input, out.String())
+		}
+	}
+}
+
+func TestJSONStream(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	vm.defglobal(vm.intern("src"), mkstreamr("src", strings.NewReader(`1 "two" [3] {"four":4}`)))
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		// successive reads from a stream continue where the last stopped
+		{`(json-read src)`, "1"},
+		{`(join (json-read src) (json-read src))`, `("two" 3)`},
+		// ins is the default stream
+		{`(dyn ins src (json-read nil nil 'alist))`, `(("four" . 4))`},
+		{`(json-read src 'eof)`, "eof"},
+		// with ins nil, the default is the current input, which is
+		// the source being evaluated
+		{"(json-read) {\"from\": \"source\"}", `(lit tab ("from" . "source"))`},
+		{`(json-read nil 'eof)`, "eof"},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Errors returned when an evaluation exceeds one of the VM's limits.
+var (
+	ErrStepLimit  = errors.New("step limit exceeded")
+	ErrCellLimit  = errors.New("cell limit exceeded")
+	ErrDepthLimit = errors.New("depth limit exceeded")
+)
+
+// Limits bound the resources that an evaluation may use.
+// A limit of zero means that there is no limit.
+//
+// Every pair that a program causes the VM to create counts against
+// the cell limit, and so do the numbers that arithmetic creates.
+// Primitives that may run for a long time without returning to the
+// evaluator, such as append, check the cell limit and the context as
+// they go. Primitives that only walk a list, such as the checks for
+// strings and proper lists, stop when they find a cycle.
+//
+// The limits apply to each call to Check, Execute, ExecuteContext, Load,
+// or MacroExpand, and to each expression entered in an interactive session.
+// They do not apply to loading the prelude.
+type Limits struct {
+	Steps int // op codes executed
+	Cells int // pairs allocated by the program
+	Depth int // frames on the stack
+}
+
+// WithLimits is an option that sets the limits for the VM
+func WithLimits(l Limits) Option {
+	return func(vm *VM) {
+		vm.limits = l
+	}
+}
+
+// ctxCheck is the number of steps between checks of the context,
+// which are slower than checks of the other limits.
+const ctxCheck = 1024
+
+// begin resets the counts that limits are checked against and sets
+// the context for the evaluation that is starting.
+func (vm *VM) begin(ctx context.Context) {
+	vm.ctx, vm.steps, vm.cells, vm.polls = ctx, 0, 0, 0
+}
+
+// exceeded returns an error if the evaluation has exceeded a limit
+// or if its context is done. The error includes the position of the
+// top level expression being evaluated.
+func (vm *VM) exceeded() error {
+	var err error
+	if vm.limits.Steps > 0 && vm.steps > vm.limits.Steps {
+		err = ErrStepLimit
+	} else if vm.limits.Cells > 0 && vm.cells > vm.limits.Cells {
+		err = ErrCellLimit
+	} else if vm.limits.Depth > 0 && len(vm.frames.stack) > vm.limits.Depth {
+		err = ErrDepthLimit
+	} else if vm.ctx != nil && vm.steps%ctxCheck == 0 {
+		err = vm.ctx.Err()
+	}
+	return vm.limitError(err)
+}
+
+// numBits is the number of bits in the parts of a number that count
+// as one cell against the cell limit. It is the size of a pair.
+const numBits = 128
+
+// numcells returns the number of cells that a number counts as
+func numcells(a *cell) int {
+	bits := 0
+	for _, r := range []*big.Rat{numr(a), numi(a)} {
+		bits += r.Num().BitLen() + r.Denom().BitLen()
+	}
+	return bits / numBits
+}
+
+// charge counts the operands of an arithmetic operation against the
+// cell limit before the operation is done. The size of the result is
+// bounded by the sizes of the operands, so a program can't grow a
+// number without bound by squaring it over and over.
+// It returns an error if a limit has been exceeded.
+func (vm *VM) charge(x, y *cell) error {
+	vm.cells += numcells(x) + numcells(y)
+	return vm.poll()
+}
+
+// poll returns an error if the evaluation has exceeded the cell limit
+// or if its context is done. Primitives that loop call it on each pass
+// so that they stop even though the evaluator isn't stepping.
+func (vm *VM) poll() error {
+	vm.polls++
+	var err error
+	if vm.limits.Cells > 0 && vm.cells > vm.limits.Cells {
+		err = ErrCellLimit
+	} else if vm.ctx != nil && vm.polls%ctxCheck == 0 {
+		err = vm.ctx.Err()
+	}
+	return vm.limitError(err)
+}
+
+// islimit returns true if the error is from exceeding a limit or from
+// the context being done. These errors stop the evaluation; programs
+// can't catch them.
+func islimit(err error) bool {
+	return errors.Is(err, ErrStepLimit) || errors.Is(err, ErrCellLimit) || errors.Is(err, ErrDepthLimit) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// limitError adds the position of the top level expression being
+// evaluated to an error from exceeding a limit
+func (vm *VM) limitError(err error) error {
+	if err == nil {
+		return nil
+	} else if pos := vm.global.position.String(); pos != "" {
+		return fmt.Errorf("%s: %w", pos, err)
+	}
+	return err
+}
+
+// Retained returns the number of pairs reachable from the global
+// environment, which are the ones that the VM keeps between
+// evaluations. Counting stops once the count exceeds max, if max is
+// positive, so that checking a bound costs no more than the bound.
+func (vm *VM) Retained(max int) int {
+	var stack []*cell
+	for _, b := range vm.globe {
+		stack = append(stack, b)
+	}
+	seen, n := map[*cell]bool{}, 0
+	for len(stack) != 0 && (max <= 0 || n <= max) {
+		a := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if a == nil || seen[a] {
+			continue
+		}
+		if ispair(a) {
+			seen[a] = true
+			n++
+			stack = append(stack, car(a), cdr(a))
+		} else if iscontinuation(a) {
+			seen[a] = true
+			k := a._object._cont
+			stack = append(stack, k.env, k.dyn)
+			for _, f := range k.frames {
+				stack = append(stack, f.env, f.dyn, f.args, f.code)
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,124 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	// double doubles the list x once for each element of n
+	double := `(set double (fn (x n) (if n (double (append x x) (cdr n)) x)))`
+	n24 := "'(" + strings.Repeat("1 ", 24) + ")"
+	for _, tc := range []struct {
+		limits Limits
+		input  string
+		expect error
+	}{
+		{Limits{Steps: 10000}, `(set f (fn () (f))) (f)`, ErrStepLimit},
+		{Limits{Depth: 100}, `(set f (fn (n) (join (f n) n))) (f 1)`, ErrDepthLimit},
+		{Limits{Cells: 1000}, `(set f (fn (x) (f (join x x)))) (f nil)`, ErrCellLimit},
+		// append copies the lists in one step
+		{Limits{Cells: 200000}, double + ` (double '(a) ` + n24 + `)`, ErrCellLimit},
+		// a program can't catch the error from a limit
+		{Limits{Cells: 200000}, double + ` (ccc (fn (c) (dyn err (fn (e) (c 'caught)) (double '(a) ` + n24 + `))))`, ErrCellLimit},
+		{Limits{Steps: 10000}, `(set f (fn () (f))) (ccc (fn (c) (dyn err (fn (e) (c 'caught)) (f))))`, ErrStepLimit},
+		// numbers count against the cell limit, so squaring stops long
+		// before the numbers are too big to multiply
+		{Limits{Cells: 10000}, `(set f (fn (x) (f (* x x)))) (f 2)`, ErrCellLimit},
+		{Limits{Cells: 10000}, `(set f (fn (x) (f (/ (* x x) 3)))) (f 2)`, ErrCellLimit},
+	} {
+		vm := NewVM(nil, WithoutPrelude(), WithLimits(tc.limits))
+		_, err := vm.Eval(context.Background(), tc.input)
+		if !errors.Is(err, tc.expect) {
+			t.Errorf("%s: expected %v: got %v", tc.input, tc.expect, err)
+		}
+	}
+
+	// the limits apply to each evaluation, not to the VM
+	vm := NewVM(nil, WithoutPrelude(), WithLimits(Limits{Steps: 1000}))
+	for i := 0; i < 3; i++ {
+		if _, err := vm.Eval(context.Background(), `(set f (fn (n) (if n (f (cdr n))))) (f '(1 2 3 4 5 6 7 8 9))`); err != nil {
+			t.Errorf("evaluation %d: expected no error: got %v", i, err)
+		}
+	}
+}
+
+func TestLimitsContext(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	loop := `(set f (fn () (f))) (f)`
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := vm.Eval(ctx, loop); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled: expected %v: got %v", context.Canceled, err)
+	}
+
+	for _, input := range []string{
+		loop,
+		// append polls the context while it copies a circular list
+		`(append '#1=(a . #1) nil)`,
+		// so does a number applied to a circular list
+		`(100000000000000000000 '#1=(a . #1))`,
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := vm.Eval(ctx, input)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected %v: got %v", input, context.DeadlineExceeded, err)
+		}
+	}
+}
+
+func TestRetained(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	base := vm.Retained(0)
+	for _, tc := range []struct {
+		input  string
+		expect int // pairs retained beyond the base
+	}{
+		// the binding is a pair too
+		{`(set x '(a b c))`, 4},
+		{`(set x nil)`, 1},
+		{`(set y '#1=(a . #1))`, 3},
+		// garbage isn't retained
+		{`(join (join 1 2) 3)`, 3},
+	} {
+		if _, err := vm.Eval(context.Background(), tc.input); err != nil {
+			t.Fatalf("%s: %v", tc.input, err)
+		}
+		if got := vm.Retained(0) - base; got != tc.expect {
+			t.Errorf("%s: expected %d: got %d", tc.input, tc.expect, got)
+		}
+	}
+	// counting stops after the bound
+	if got := vm.Retained(1); got != 2 {
+		t.Errorf("bound 1: expected 2: got %d", got)
+	}
+}
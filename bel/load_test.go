@@ -0,0 +1,113 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, text := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		} else if err := os.WriteFile(name, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.bel":   `(set x 1) (load "sub/a.bel") (set z (+ y 1))`,
+		"sub/a.bel":  `(set y (+ x 1)) (load "b.bel")`,
+		"sub/b.bel":  `(set w 'b)`,
+		"cycle1.bel": `(load "cycle2.bel")`,
+		"cycle2.bel": `(load "cycle1.bel")`,
+		"bad.bel":    "(set e1 1)\n(car 'x)\n(set e2 2)",
+	})
+	vm := NewVM(nil)
+
+	// relative names are relative to the file being loaded
+	if err := vm.Load(filepath.Join(dir, "main.bel")); err != nil {
+		t.Fatalf("load main.bel: %v", err)
+	}
+	if v, err := vm.Eval(context.Background(), `(list x y z w)`); err != nil {
+		t.Errorf("load main.bel: %v", err)
+	} else if got := v.String(); got != "(1 2 3 b)" {
+		t.Errorf("load main.bel: expected (1 2 3 b): got %s", got)
+	}
+
+	err := vm.Load(filepath.Join(dir, "cycle1.bel"))
+	var e *Error
+	if !errors.As(err, &e) || e.Value.String() != "load-cycle" {
+		t.Errorf("load cycle1.bel: expected load-cycle: got %v", err)
+	}
+
+	// an error stops the file and is reported with its position
+	err = vm.Load(filepath.Join(dir, "bad.bel"))
+	if !errors.As(err, &e) || e.Value.String() != "car-on-atom" {
+		t.Errorf("load bad.bel: expected car-on-atom: got %v", err)
+	} else if e.Position.Name != filepath.Join(dir, "bad.bel") || e.Position.Line != 2 {
+		t.Errorf("load bad.bel: expected line 2 of bad.bel: got %s", e.Position)
+	}
+	if v, err := vm.Eval(context.Background(), `(list e1 (safe e2))`); err != nil {
+		t.Errorf("load bad.bel: %v", err)
+	} else if got := v.String(); got != "(1 nil)" {
+		t.Errorf("load bad.bel: expected (1 nil): got %s", got)
+	}
+
+	// the caller's input is restored after an error in a loaded file
+	src := `(onerr 'caught (load "` + filepath.Join(dir, "bad.bel") + `")) 'after`
+	if values, err := vm.Execute([]byte(src)); err != nil {
+		t.Errorf("onerr load: %v", err)
+	} else if len(values) != 2 || values[0].String() != "caught" || values[1].String() != "after" {
+		t.Errorf("onerr load: expected [caught after]: got %v", values)
+	}
+
+	if _, err := vm.Eval(context.Background(), `(load "`+filepath.Join(dir, "missing.bel")+`")`); !errors.As(err, &e) || e.Value.String() != "cannot-open" {
+		t.Errorf("load missing.bel: expected cannot-open: got %v", err)
+	}
+}
+
+func TestLoadStream(t *testing.T) {
+	vm := NewVM(nil)
+	vm.defglobal(vm.intern("s"), mkstreamr("s", strings.NewReader("(set a 1) (set b (+ a 1))")))
+	if v, err := vm.Eval(context.Background(), `(list (load s) a b)`); err != nil {
+		t.Errorf("load stream: %v", err)
+	} else if got := v.String(); got != "(nil 1 2)" {
+		t.Errorf("load stream: expected (nil 1 2): got %s", got)
+	}
+	if len(vm.ins) != 1 || vm.loadReaders != 0 {
+		t.Errorf("load stream: expected the console only: got %d inputs", len(vm.ins))
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMacroExpand(t *testing.T) {
+	vm := NewVM(nil)
+	if _, err := vm.Execute([]byte(`
+(mac m1 (x) (list 'm2 x))
+(mac m2 (x) (list 'm3 x))
+(mac m3 (x) (list 'quote x))
+`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(macroexpand-1 '(m1 a))`, `(m2 a)`},
+		{`(macroexpand '(m1 a))`, `'a`},
+		{`(macroexpand '(m3 a))`, `'a`},
+		{`(macroexpand '(car x))`, `(car x)`},
+		{`(macroexpand 'a)`, `a`},
+		{`(macroexpand '(aif 1 2))`, `((fn (#1=((nil))) (if #1 (let it #1 2) (iflet it))) 1)`},
+		{`(m1 a)`, `a`},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+
+	form, err := vm.Eval(context.Background(), `'(m1 (m1 b))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the outermost form is expanded
+	if v, err := vm.MacroExpand(form); err != nil {
+		t.Errorf("MacroExpand: %v", err)
+	} else if got := v.String(); got != `'(m1 b)` {
+		t.Errorf("MacroExpand: expected '(m1 b): got %s", got)
+	}
+}
+
+func TestApplyMacro(t *testing.T) {
+	vm := NewVM(nil)
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(apply or '(nil 2 3))`, `2`},
+		{`(apply and '(1 2 3))`, `3`},
+		{`(apply or nil)`, `nil`},
+		{`(map or '(nil 1) '(2 nil))`, `(2 1)`},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+
+	// the expansion is evaluated in the null environment
+	if _, err := vm.Eval(context.Background(), `(let y 5 (apply (macro () 'y) nil))`); err == nil {
+		t.Errorf("lexical variable in expansion: expected unbound error")
+	}
+}
@@ -0,0 +1,424 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Marshal returns the Bel value for a Go value.
+//
+// Booleans become t or nil. Integers and floats become numbers; a float
+// becomes the shortest decimal that rounds to it. Strings become Bel
+// strings, which are lists of characters. Slices and arrays become lists.
+// Maps become lists of (key . value) pairs, sorted by key. Structs become
+// lists of ("name" . value) pairs for their exported fields, in order.
+// Pointers and interfaces become the value they refer to, and nil
+// pointers, slices, maps, and interfaces become nil. A Value is
+// returned unchanged. NaN, infinities, and values that refer to
+// themselves can't be marshaled.
+//
+// The name of a field is its name in Go unless the field's tag has a
+// bel key. The tag bel:"-" skips the field, and the option omitempty
+// skips the field if it has the zero value, as with encoding/json:
+//
+//	Name string `bel:"name,omitempty"`
+//
+// Since the empty string, false, and the empty list are all nil in Bel,
+// they can't be told apart after marshaling.
+func Marshal(v interface{}) (Value, error) {
+	return fromGo(reflect.ValueOf(v))
+}
+
+// Unmarshal stores a Bel value in the Go value that v points to.
+// It reverses the conversions that Marshal makes. Structs and maps may
+// also be given as lists of pairs with symbols for keys, strings may be
+// given as symbols, and nil is the zero value of any type.
+// An empty interface gets the natural Go value: nil, true, an int64,
+// a float64, a string for a character, symbol, or string, or an
+// []interface{} for any other list.
+func Unmarshal(a Value, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("bel: unmarshal: %T is not a non-nil pointer", v)
+	}
+	x, err := toGo(a, rv.Elem().Type())
+	if err != nil {
+		return fmt.Errorf("bel: unmarshal %s into %s: %w", a, rv.Elem().Type(), err)
+	}
+	rv.Elem().Set(x)
+	return nil
+}
+
+// errMistype is returned when a value can't be converted
+var errMistype = errors.New("mistype")
+
+var valueType = reflect.TypeOf(Value{})
+
+// field is an exported struct field and the name it has in Bel
+type field struct {
+	index     int
+	name      string
+	omitempty bool
+}
+
+// fields returns the fields of a struct type that Marshal converts
+func fields(t reflect.Type) []field {
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		f := field{index: i, name: sf.Name}
+		if tag, ok := sf.Tag.Lookup("bel"); ok {
+			if tag == "-" {
+				continue
+			}
+			opts := strings.Split(tag, ",")
+			if opts[0] != "" {
+				f.name = opts[0]
+			}
+			for _, opt := range opts[1:] {
+				f.omitempty = f.omitempty || opt == "omitempty"
+			}
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// key returns the Go string for the key of a pair in an alist
+func key(a Value) (string, bool) {
+	if s, ok := a.Symbol(); ok && a.cell() != _NIL {
+		return s, true
+	}
+	return a.Text()
+}
+
+// toGo converts a value to a Go value of type t
+func toGo(a Value, t reflect.Type) (reflect.Value, error) {
+	c := a.cell()
+	rv := reflect.New(t).Elem()
+	if c == _NIL && t.Kind() != reflect.Bool && t.Kind() != reflect.Interface && t != valueType {
+		// nil is the empty list, the empty string, and false
+		return rv, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		rv.SetBool(c != _NIL)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := a.Int()
+		if !ok || rv.OverflowInt(n) {
+			return rv, errMistype
+		}
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !isint(c) || numr(c).Sign() < 0 || !numr(c).Num().IsUint64() {
+			return rv, errMistype
+		}
+		n := numr(c).Num().Uint64()
+		if rv.OverflowUint(n) {
+			return rv, errMistype
+		}
+		rv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, ok := a.Float()
+		if !ok {
+			return rv, errMistype
+		}
+		rv.SetFloat(f)
+	case reflect.String:
+		s, ok := key(a)
+		if !ok {
+			return rv, errMistype
+		}
+		rv.SetString(s)
+	case reflect.Slice:
+		elts, ok := a.Slice()
+		if !ok {
+			return rv, errMistype
+		}
+		rv.Set(reflect.MakeSlice(t, len(elts), len(elts)))
+		for i, e := range elts {
+			v, err := toGo(e, t.Elem())
+			if err != nil {
+				return rv, err
+			}
+			rv.Index(i).Set(v)
+		}
+	case reflect.Array:
+		elts, ok := a.Slice()
+		if !ok || len(elts) != t.Len() {
+			return rv, errMistype
+		}
+		for i, e := range elts {
+			v, err := toGo(e, t.Elem())
+			if err != nil {
+				return rv, err
+			}
+			rv.Index(i).Set(v)
+		}
+	case reflect.Map:
+		pairs, ok := a.Slice()
+		if !ok {
+			return rv, errMistype
+		}
+		rv.Set(reflect.MakeMapWithSize(t, len(pairs)))
+		for _, p := range pairs {
+			if !p.IsPair() {
+				return rv, errMistype
+			}
+			k, err := toGo(p.Car(), t.Key())
+			if err != nil {
+				return rv, err
+			}
+			v, err := toGo(p.Cdr(), t.Elem())
+			if err != nil {
+				return rv, err
+			}
+			rv.SetMapIndex(k, v)
+		}
+	case reflect.Ptr:
+		v, err := toGo(a, t.Elem())
+		if err != nil {
+			return rv, err
+		}
+		rv.Set(reflect.New(t.Elem()))
+		rv.Elem().Set(v)
+	case reflect.Struct:
+		if t == valueType {
+			rv.Set(reflect.ValueOf(a))
+			break
+		}
+		pairs, ok := a.Slice()
+		if !ok {
+			return rv, errMistype
+		}
+		byName := map[string]Value{}
+		for _, p := range pairs {
+			k, ok := key(p.Car())
+			if !p.IsPair() || !ok {
+				return rv, errMistype
+			}
+			byName[k] = p.Cdr()
+		}
+		for _, f := range fields(t) {
+			if fv, ok := byName[f.name]; ok {
+				v, err := toGo(fv, t.Field(f.index).Type)
+				if err != nil {
+					return rv, err
+				}
+				rv.Field(f.index).Set(v)
+			}
+		}
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return rv, errMistype
+		}
+		if v := natural(a); v != nil {
+			rv.Set(reflect.ValueOf(v))
+		}
+	default:
+		return rv, errMistype
+	}
+	return rv, nil
+}
+
+// natural returns the Go value that an empty interface gets for a value
+func natural(a Value) interface{} {
+	switch c := a.cell(); {
+	case c == _NIL:
+		return nil
+	case c == _TRUE:
+		return true
+	case isint(c):
+		if n, ok := a.Int(); ok {
+			return n
+		}
+		f, _ := a.Float()
+		return f
+	case isreal(c):
+		f, _ := a.Float()
+		return f
+	case ischar(c):
+		r, _ := a.Char()
+		return string(r)
+	case issymbol(c):
+		s, _ := a.Symbol()
+		return s
+	case isstring(c):
+		s, _ := a.Text()
+		return s
+	case proper(c):
+		elts, _ := a.Slice()
+		xs := make([]interface{}, len(elts))
+		for i, e := range elts {
+			xs[i] = natural(e)
+		}
+		return xs
+	}
+	return a
+}
+
+// fromGo converts a Go value to a value
+func fromGo(rv reflect.Value) (Value, error) {
+	return marshaler{}.fromGo(rv)
+}
+
+// marshaler holds the pointers, maps, and slices that are being
+// converted, so that a value that refers to itself is an error
+// rather than endless recursion.
+type marshaler map[visit]bool
+
+// visit is a pointer to a value being converted. The length tells
+// slices that share an array apart.
+type visit struct {
+	ptr uintptr
+	len int
+}
+
+// fromGo converts a Go value to a value
+func (m marshaler) fromGo(rv reflect.Value) (Value, error) {
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if !rv.IsNil() {
+			v := visit{ptr: rv.Pointer()}
+			if rv.Kind() == reflect.Slice {
+				v.len = rv.Len()
+			}
+			if m[v] {
+				return Nil, fmt.Errorf("bel: can't marshal cyclic %s", rv.Type())
+			}
+			m[v] = true
+			defer delete(m, v)
+		}
+	}
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return Nil, nil
+	case reflect.Bool:
+		return Value{truth(rv.Bool())}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Value{mknumber(new(big.Rat).SetUint64(rv.Uint()), rzero)}, nil
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return Nil, fmt.Errorf("bel: can't marshal %v", f)
+		}
+		return Float(rv.Float()), nil
+	case reflect.String:
+		return String(rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return Nil, nil
+		}
+		elts := make([]Value, rv.Len())
+		for i := range elts {
+			v, err := m.fromGo(rv.Index(i))
+			if err != nil {
+				return Nil, err
+			}
+			elts[i] = v
+		}
+		return List(elts...), nil
+	case reflect.Map:
+		// the pairs are sorted by key so that the result is repeatable
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keyless(keys[i], keys[j])
+		})
+		pairs := make([]Value, len(keys))
+		for i, k := range keys {
+			kv, err := m.fromGo(k)
+			if err != nil {
+				return Nil, err
+			}
+			vv, err := m.fromGo(rv.MapIndex(k))
+			if err != nil {
+				return Nil, err
+			}
+			pairs[i] = Cons(kv, vv)
+		}
+		return List(pairs...), nil
+	case reflect.Interface, reflect.Ptr:
+		if rv.IsNil() {
+			return Nil, nil
+		}
+		return m.fromGo(rv.Elem())
+	case reflect.Struct:
+		if rv.Type() == valueType {
+			return rv.Interface().(Value), nil
+		}
+		var pairs []Value
+		for _, f := range fields(rv.Type()) {
+			fv := rv.Field(f.index)
+			if f.omitempty && fv.IsZero() {
+				continue
+			}
+			v, err := m.fromGo(fv)
+			if err != nil {
+				return Nil, err
+			}
+			pairs = append(pairs, Cons(String(f.name), v))
+		}
+		return List(pairs...), nil
+	}
+	return Nil, fmt.Errorf("bel: can't marshal %s", rv.Type())
+}
+
+// keyless returns true if the map key a sorts before b.
+// Numbers sort by value and strings in byte order. Keys of other
+// kinds, or of different kinds in an interface, sort by their text.
+func keyless(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Interface {
+		a = a.Elem()
+	}
+	if b.Kind() == reflect.Interface {
+		b = b.Elem()
+	}
+	if a.Kind() == b.Kind() {
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Bool:
+			return !a.Bool() && b.Bool()
+		}
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
@@ -0,0 +1,168 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type marshalAddress struct {
+	Street string `bel:"street"`
+	Zip    int    `bel:"zip,omitempty"`
+}
+
+type marshalPerson struct {
+	Name    string            `bel:"name"`
+	Age     int               `bel:"age"`
+	Score   float64           `bel:"score"`
+	Admin   bool              `bel:"admin"`
+	Tags    []string          `bel:"tags"`
+	Counts  map[string]uint8  `bel:"counts"`
+	Home    *marshalAddress   `bel:"home"`
+	Work    *marshalAddress   `bel:"work"`
+	Extra   map[int][]float32 `bel:"extra"`
+	Skipped string            `bel:"-"`
+	private int
+}
+
+func TestMarshal(t *testing.T) {
+	p := marshalPerson{
+		Name:   "Ada",
+		Age:    36,
+		Score:  0.1,
+		Admin:  true,
+		Tags:   []string{"math", "engines"},
+		Counts: map[string]uint8{"a": 1, "b": 255},
+		Home:   &marshalAddress{Street: "St James's Square"},
+		Extra:  map[int][]float32{2: {1.5, -3}},
+	}
+	v, err := Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `(("name" . "Ada") ("age" . 36) ("score" . 1/10) ("admin" . t) ("tags" "math" "engines") ("counts" ("a" . 1) ("b" . 255)) ("home" ("street" . "St James's Square")) ("work") ("extra" (2 3/2 -3)))`
+	if got := v.String(); got != expect {
+		t.Errorf("marshal: expected %s: got %s", expect, got)
+	}
+
+	var q marshalPerson
+	if err := Unmarshal(v, &q); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, q) {
+		t.Errorf("round trip: expected %+v: got %+v", p, q)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	for _, tc := range []struct {
+		input  string
+		expect interface{}
+	}{
+		{`'((name . "Bob") (age . 7))`, marshalPerson{Name: "Bob", Age: 7}},
+		{`'(1 2 3)`, []int{1, 2, 3}},
+		{`'abc`, "abc"},
+		{`nil`, ""},
+		{`'((1 . a) (2 . "b"))`, map[int]interface{}{1: "a", 2: "b"}},
+		{`'(1 1/2 \x (t nil))`, []interface{}{int64(1), 0.5, "x", []interface{}{true, nil}}},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.input, err)
+		}
+		got := reflect.New(reflect.TypeOf(tc.expect))
+		if err := Unmarshal(v, got.Interface()); err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if !reflect.DeepEqual(got.Elem().Interface(), tc.expect) {
+			t.Errorf("%s: expected %#v: got %#v", tc.input, tc.expect, got.Elem().Interface())
+		}
+	}
+
+	var n int
+	if err := Unmarshal(String("x"), &n); err == nil {
+		t.Errorf("unmarshal string into int: expected error")
+	}
+}
+
+func TestMarshalKeys(t *testing.T) {
+	for _, tc := range []struct {
+		input  interface{}
+		expect string
+	}{
+		{map[int]string{10: "a", 9: "b", -1: "c"}, `((-1 . "c") (9 . "b") (10 . "a"))`},
+		{map[uint]bool{100: true, 20: false}, `((20) (100 . t))`},
+		{map[float64]int{2.5: 1, 10: 2, -0.5: 3}, `((-1/2 . 3) (5/2 . 1) (10 . 2))`},
+		{map[string]int{"b": 1, "a": 2, "B": 3}, `(("B" . 3) ("a" . 2) ("b" . 1))`},
+		{map[interface{}]int{10: 1, 9: 2}, `((9 . 2) (10 . 1))`},
+	} {
+		v, err := Marshal(tc.input)
+		if err != nil {
+			t.Errorf("%v: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%v: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+}
+
+type marshalNode struct {
+	Next *marshalNode
+}
+
+func TestMarshalErrors(t *testing.T) {
+	cyclic := &marshalNode{}
+	cyclic.Next = cyclic
+	loop := []interface{}{nil}
+	loop[0] = loop
+	m := map[string]interface{}{}
+	m["m"] = m
+
+	for name, input := range map[string]interface{}{
+		"NaN":       math.NaN(),
+		"+Inf":      math.Inf(1),
+		"-Inf":      []float32{float32(math.Inf(-1))},
+		"pointer":   cyclic,
+		"slice":     loop,
+		"map":       m,
+		"channel":   make(chan int),
+		"map value": map[string]float64{"x": math.NaN()},
+	} {
+		if v, err := Marshal(input); err == nil {
+			t.Errorf("%s: expected error: got %s", name, v)
+		}
+	}
+
+	// a value may appear more than once if it doesn't refer to itself
+	shared := &marshalNode{}
+	v, err := Marshal([]*marshalNode{shared, shared})
+	if err != nil {
+		t.Errorf("shared: %v", err)
+	} else if expect := `((("Next")) (("Next")))`; v.String() != expect {
+		t.Errorf("shared: expected %s: got %s", expect, v)
+	}
+}
@@ -0,0 +1,410 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// natives replace definitions in the prelude that depend on Bel's
+// representation of numbers and streams, or that are too slow to
+// run in Bel. They are bound before the prelude is loaded, and the
+// prelude skips its own definitions of them.
+var natives = []*primitive{
+	{name: "=", arity: -1, fn: primEqual},
+	{name: "append", arity: -1, fn: primAppend},
+	{name: "bin<", arity: 2, fn: primBinLess},
+	{name: "number", arity: 1, fn: primNumber},
+	{name: "real", arity: 1, fn: primReal},
+	{name: "int", arity: 1, fn: primInt},
+	{name: "whole", arity: 1, fn: primWhole},
+	{name: "pint", arity: 1, fn: primPint},
+	{name: "rpart", arity: 1, fn: primRpart},
+	{name: "ipart", arity: 1, fn: primIpart},
+	{name: "inv", arity: 1, fn: primInv},
+	{name: "recip", arity: 1, fn: primRecip},
+	{name: "abs", arity: 1, fn: primAbs},
+	{name: "floor", arity: 1, fn: primFloor},
+	{name: "charn", arity: 1, fn: primCharn},
+	{name: "rand", arity: 1, fn: primRand},
+	{name: "print", arity: 2, fn: primPrint},
+	{name: "pr", arity: -1, fn: primPr},
+	{name: "prn", arity: -1, fn: primPrn},
+}
+
+// applytab returns the op to apply a table to a key and an optional
+// default, as the virfn for tab in the prelude does. Keys are compared
+// with =. In a where, the location is the cdr of the key's pair, which
+// is added to the table if it isn't there, as tabloc does.
+// The error is from exceeding a limit.
+func (vm *VM) applytab(tab, args *cell) (opcode, error) {
+	if args == _NIL {
+		return vm.sigerr("underargs", tab), nil
+	} else if ispair(cdr(args)) && cdr(cdr(args)) != _NIL {
+		return vm.sigerr("overargs", args), nil
+	}
+	key, kv := car(args), _NIL
+	for kvs := cdr(cdr(tab)); kv == _NIL && ispair(kvs); kvs = cdr(kvs) {
+		if err := vm.poll(); err != nil {
+			return opcInvalid, err
+		} else if !ispair(car(kvs)) {
+			continue
+		} else if ok, err := equal(vm, car(car(kvs)), key); err != nil {
+			return opcInvalid, err
+		} else if ok {
+			kv = car(kvs)
+		}
+	}
+	if vm.inwhere() {
+		if kv == _NIL {
+			kv = vm.cons(key, _NIL)
+			setcdr(cdr(tab), vm.cons(kv, cdr(cdr(tab))))
+		}
+		vm.sreturn(vm.list(kv, vm._D))
+		return opcWhere2, nil
+	} else if kv == _NIL {
+		return vm.sreturn(nth(args, 1)), nil
+	}
+	return vm.sreturn(cdr(kv)), nil
+}
+
+// applyarr returns the op to apply an array to indexes, as the virfn
+// for arr in the prelude does. Each index but the last selects a
+// subarray. The last is applied to the elements like any number, so
+// it works in a where too. The error is from exceeding a limit.
+func (vm *VM) applyarr(arr, args *cell) (opcode, error) {
+	if args == _NIL {
+		return vm.sigerr("underargs", arr), nil
+	}
+	for ; ispair(cdr(args)); args = cdr(args) {
+		n := car(args)
+		if !isint(n) || numr(n).Sign() <= 0 {
+			return vm.sigerr("mistype", n), nil
+		}
+		xs, err := vm.nthlist(numr(n).Num(), cdr(cdr(arr)))
+		if err != nil {
+			return opcInvalid, err
+		} else if !ispair(xs) || !ispair(car(xs)) || car(car(xs)) != vm._LIT || nth(car(xs), 1) != vm._ARR {
+			return vm.sigerr("mistype", arr), nil
+		}
+		arr = car(xs)
+	}
+	vm.global.code, vm.global.args = car(args), vm.list(cdr(cdr(arr)))
+	return opcApply, nil
+}
+
+// equal returns true if x and y are the same tree.
+// Atoms are equal if they are identical, except that numbers and
+// characters are equal if they have the same value.
+// The trees are walked with an explicit stack, so deep trees don't
+// overflow the Go stack. A pair of pairs that is reached a second time
+// is taken to be equal, so circular trees are compared without looping.
+func equal(vm *VM, x, y *cell) (bool, error) {
+	visited := map[[2]*cell]bool{}
+	for stack := [][2]*cell{{x, y}}; len(stack) != 0; {
+		if err := vm.poll(); err != nil {
+			return false, err
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := top[0], top[1]
+		if x == y {
+			continue
+		} else if isnumber(x) && isnumber(y) {
+			if !numeq(x, y) {
+				return false, nil
+			}
+			continue
+		} else if ischar(x) && ischar(y) {
+			if aschar(x) != aschar(y) {
+				return false, nil
+			}
+			continue
+		} else if !ispair(x) || !ispair(y) {
+			return false, nil
+		} else if visited[top] {
+			continue
+		}
+		visited[top] = true
+		stack = append(stack, [2]*cell{cdr(x), cdr(y)}, [2]*cell{car(x), car(y)})
+	}
+	return true, nil
+}
+
+// primEqual implements (= args)
+func primEqual(vm *VM, args []*cell) (*cell, error) {
+	for i := 1; i < len(args); i++ {
+		if ok, err := equal(vm, args[0], args[i]); err != nil {
+			return nil, err
+		} else if !ok {
+			return _NIL, nil
+		}
+	}
+	return _TRUE, nil
+}
+
+// primAppend implements (append args).
+// Every list but the last is copied.
+func primAppend(vm *VM, args []*cell) (*cell, error) {
+	if len(args) == 0 {
+		return _NIL, nil
+	}
+	list := args[len(args)-1]
+	for i := len(args) - 2; i >= 0; i-- {
+		// the lists may be long, so poll while copying
+		rev := _NIL
+		for a := args[i]; ispair(a); a = cdr(a) {
+			if err := vm.poll(); err != nil {
+				return nil, err
+			}
+			rev = vm.cons(car(a), rev)
+		}
+		list = vm.reverse(rev, list)
+	}
+	return list, nil
+}
+
+// primBinLess implements (bin< x y)
+func primBinLess(vm *VM, args []*cell) (*cell, error) {
+	less, err := binless(args[0], args[1])
+	return truth(less), err
+}
+
+// primNumber implements (number x)
+func primNumber(vm *VM, args []*cell) (*cell, error) {
+	return truth(isnumber(args[0])), nil
+}
+
+// primReal implements (real x)
+func primReal(vm *VM, args []*cell) (*cell, error) {
+	return truth(isreal(args[0])), nil
+}
+
+// primInt implements (int n)
+func primInt(vm *VM, args []*cell) (*cell, error) {
+	return truth(isint(args[0])), nil
+}
+
+// primWhole implements (whole n), which is true for integers >= 0
+func primWhole(vm *VM, args []*cell) (*cell, error) {
+	return truth(isint(args[0]) && numr(args[0]).Sign() >= 0), nil
+}
+
+// primPint implements (pint n), which is true for integers > 0
+func primPint(vm *VM, args []*cell) (*cell, error) {
+	return truth(isint(args[0]) && numr(args[0]).Sign() > 0), nil
+}
+
+// primRpart implements (rpart n), the real part of a number
+func primRpart(vm *VM, args []*cell) (*cell, error) {
+	if !isnumber(args[0]) {
+		return nil, errors.New("mistype")
+	}
+	return mknumber(numr(args[0]), rzero), nil
+}
+
+// primIpart implements (ipart n), the imaginary part of a number
+func primIpart(vm *VM, args []*cell) (*cell, error) {
+	if !isnumber(args[0]) {
+		return nil, errors.New("mistype")
+	}
+	return mknumber(numi(args[0]), rzero), nil
+}
+
+// primInv implements (inv n), which returns -n
+func primInv(vm *VM, args []*cell) (*cell, error) {
+	if !isnumber(args[0]) {
+		return nil, errors.New("mistype")
+	}
+	return numsub(mkint(0), args[0]), nil
+}
+
+// primRecip implements (recip n), which returns 1/n
+func primRecip(vm *VM, args []*cell) (*cell, error) {
+	if !isnumber(args[0]) {
+		return nil, errors.New("mistype")
+	}
+	return numdiv(mkint(1), args[0])
+}
+
+// primAbs implements (abs n) for real numbers
+func primAbs(vm *VM, args []*cell) (*cell, error) {
+	if !isreal(args[0]) {
+		return nil, errors.New("mistype")
+	}
+	return mknumber(new(big.Rat).Abs(numr(args[0])), rzero), nil
+}
+
+// primFloor implements (floor n) for real numbers
+func primFloor(vm *VM, args []*cell) (*cell, error) {
+	if !isreal(args[0]) {
+		return nil, errors.New("mistype")
+	}
+	// Div is Euclidean division, which rounds down because
+	// the denominator is always positive
+	r := numr(args[0])
+	q := new(big.Int).Div(r.Num(), r.Denom())
+	return mknumber(new(big.Rat).SetInt(q), rzero), nil
+}
+
+// primCharn implements (charn c), which returns the code point of a character
+func primCharn(vm *VM, args []*cell) (*cell, error) {
+	if !ischar(args[0]) {
+		return nil, errors.New("mistype")
+	}
+	return mkint(int64(aschar(args[0]))), nil
+}
+
+// primRand implements (rand n), which returns an integer from 0 to n-1
+func primRand(vm *VM, args []*cell) (*cell, error) {
+	n := args[0]
+	if !isint(n) || numr(n).Sign() <= 0 {
+		return nil, errors.New("mistype")
+	}
+	// each VM has its own source since a source isn't safe for concurrent use
+	if vm.rng == nil {
+		vm.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return mknumber(new(big.Rat).SetInt(new(big.Int).Rand(vm.rng, numr(n).Num())), rzero), nil
+}
+
+// output returns the writer for a stream argument.
+// As in Bel, a nil stream means the value of outs, which is looked up
+// in the dynamic bindings and then the global ones. If outs is nil too,
+// the writer is the VM's current output. The record macro binds outs
+// to a queue, which is written by appending characters to it.
+func (vm *VM) output(s *cell) (io.Writer, error) {
+	if s == _NIL {
+		s = vm.streamValue(vm._OUTS)
+	}
+	if s == _NIL {
+		return vm.outs[0], nil
+	} else if ispair(s) {
+		return queueWriter{vm: vm, q: s}, nil
+	} else if !isstream(s) || s._object._stream.w == nil {
+		return nil, errors.New("mistype")
+	}
+	return s._object._stream.w, nil
+}
+
+// streamValue returns the value of ins or outs, ignoring lexical
+// bindings since the default for a stream parameter is evaluated in
+// the global environment
+func (vm *VM) streamValue(v *cell) *cell {
+	for a := vm.global.dynEnv; ispair(a); a = cdr(a) {
+		if b := car(a); car(b) == v {
+			return cdr(b)
+		}
+	}
+	if b, ok := vm.globe[v]; ok {
+		return cdr(b)
+	}
+	return _NIL
+}
+
+// queueWriter appends the characters written to it to a Bel queue,
+// which is a pair whose car is the list of items in the queue.
+// Like enq, it replaces the list rather than modifying it.
+type queueWriter struct {
+	vm *VM
+	q  *cell
+}
+
+// Write implements the io.Writer interface
+func (w queueWriter) Write(p []byte) (int, error) {
+	setcar(w.q, w.vm.reverse(w.vm.reverse(car(w.q), _NIL), w.vm.chars(string(p))))
+	return len(p), nil
+}
+
+// prnice returns the text of x as pr displays it.
+// Strings and characters are displayed without delimiters.
+func prnice(x *cell) string {
+	if ischar(x) {
+		return string(aschar(x))
+	} else if x != _NIL && isstring(x) {
+		return asstring(x)
+	}
+	return x.String()
+}
+
+// primPrint implements (print x (o s)), which writes the printed
+// representation of x to the stream.
+func primPrint(vm *VM, args []*cell) (*cell, error) {
+	w, err := vm.output(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprint(w, args[0].String()); err != nil {
+		return nil, err
+	}
+	return _NIL, nil
+}
+
+// primPr implements (pr args), which displays each argument.
+// It returns the last argument.
+func primPr(vm *VM, args []*cell) (*cell, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(prnice(arg))
+	}
+	w, err := vm.output(_NIL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprint(w, sb.String()); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return _NIL, nil
+	}
+	return args[len(args)-1], nil
+}
+
+// primPrn implements (prn args), which prints each argument followed
+// by a space and then ends the line. It returns the last argument.
+func primPrn(vm *VM, args []*cell) (*cell, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(arg.String())
+		sb.WriteString(" ")
+	}
+	w, err := vm.output(_NIL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintln(w, sb.String()); err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return _NIL, nil
+	}
+	return args[len(args)-1], nil
+}
@@ -0,0 +1,179 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestOuts(t *testing.T) {
+	out := &bytes.Buffer{}
+	vm := NewVM(nil, WithIO(strings.NewReader(""), out, ioutil.Discard))
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(prs 1 "a" \b '(c "d"))`, `"1ab(c \"d\")"`},
+		{`(let q (newq) (bind outs q (pr "hi") (prn 'x "y") (print \z)) (car q))`, "\"hix \\\"y\\\" \n\\\\z\""},
+		{`(let q (newq) (bind outs q (dyn outs nil (pr 'console))) (car q))`, `nil`},
+		{`(do (set outs (newq)) (pr 'global) (car outs))`, `"global"`},
+		{`(do (set outs nil) (pr 'console))`, `console`},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+	if got := out.String(); got != "consoleconsole" {
+		t.Errorf("console: expected consoleconsole: got %q", got)
+	}
+
+	if _, err := vm.Eval(context.Background(), `(bind outs 'a (pr 1))`); err == nil {
+		t.Errorf("outs bound to a symbol: expected error")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	vm := NewVM(nil)
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(= '(a (b 1)) (list 'a (list 'b 1)))`, `t`},
+		{`(= '(a (b 1)) '(a (b 2)))`, `nil`},
+		{`(= "abc" "abc" "abd")`, `nil`},
+		{`(with (x (list 1) y (list 1)) (xdr x x) (xdr y y) (= x y))`, `t`},
+		{`(with (x (list 1) y (list 2)) (xdr x x) (xdr y y) (= x y))`, `nil`},
+		{`(with (x (list 1) y (list 1)) (xar x x) (xar y y) (= x y))`, `t`},
+		{`(with (x (list 1) y (list 1 1)) (xdr x x) (xdr (cdr y) y) (= x y))`, `t`},
+		{`(with (x (list 1) y (list 1)) (xar x x) (= x y))`, `nil`},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+
+	// a deep tree doesn't overflow the Go stack
+	deep := NewVM(nil, WithoutPrelude())
+	x, y := _NIL, _NIL
+	for i := 0; i < 1000000; i++ {
+		x, y = mkpair(x, _NIL), mkpair(y, _NIL)
+	}
+	if ok, err := equal(deep, x, y); err != nil || !ok {
+		t.Errorf("deep trees: expected true: got %v %v", ok, err)
+	}
+}
+
+func TestAfter(t *testing.T) {
+	out := &bytes.Buffer{}
+	vm := NewVM(nil, WithIO(strings.NewReader(""), out, ioutil.Discard))
+	for _, tc := range []struct {
+		input  string
+		expect string
+		output string
+	}{
+		{`(after 1 (pr 'cleanup))`, `1`, `cleanup`},
+		{`(ccc (fn (k) (after (k 1) (pr 'cleanup))))`, `1`, `cleanup`},
+		{`(safe (after (car 'a) (pr 'cleanup)))`, `nil`, `cleanup`},
+		{`(ccc (fn (k) (after (after (k 1) (pr 'a)) (pr 'b))))`, `1`, `ab`},
+		{`(ccc (fn (k) (after 1 (k 2))))`, `2`, ``},
+		{`(let x 0 (ccc (fn (k) (after (k 1) (set x 2)))) x)`, `2`, ``},
+	} {
+		out.Reset()
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		} else if got := out.String(); got != tc.output {
+			t.Errorf("%s: expected %q: got %q", tc.input, tc.output, got)
+		}
+	}
+
+	// an error that isn't handled runs the cleanup before it is reported
+	out.Reset()
+	if _, err := vm.Eval(context.Background(), `(after (after (car 'a) (pr 'a)) (pr 'b))`); err == nil {
+		t.Errorf("after: expected car-on-atom")
+	} else if e, ok := err.(*Error); !ok || e.Value.String() != "car-on-atom" {
+		t.Errorf("after: expected car-on-atom: got %v", err)
+	}
+	if got := out.String(); got != "ab" {
+		t.Errorf("after: expected %q: got %q", "ab", got)
+	}
+}
+
+func TestVir(t *testing.T) {
+	vm := NewVM(nil)
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(set y (table))`, `(lit tab)`},
+		{`(y 'a)`, `nil`},
+		{`(y 'a 0)`, `0`},
+		{`(set y!a 1)`, `1`},
+		{`(y 'a)`, `1`},
+		{`(do (set (y "b") 2) (y "b"))`, `2`},
+		{`(do (++ y!a) y!a)`, `2`},
+		{`y`, `(lit tab ("b" . 2) (a . 2))`},
+		{`(set z (array '(2 3) 0))`, `(lit arr (lit arr 0 0 0) (lit arr 0 0 0))`},
+		{`(z 2 3)`, `0`},
+		{`(do (set (z 2 3) 'x) (z 2 3))`, `x`},
+		{`((z 2) 3)`, `x`},
+		{`(z 1 4)`, `nil`},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`(y)`, `underargs`},
+		{`(y 'a 1 2)`, `overargs`},
+		{`(z)`, `underargs`},
+		{`(z 'a 1)`, `mistype`},
+		{`(z 1 1 1)`, `mistype`},
+	} {
+		if _, err := vm.Eval(context.Background(), tc.input); err == nil {
+			t.Errorf("%s: expected %s", tc.input, tc.expect)
+		} else if e, ok := err.(*Error); !ok || e.Value.String() != tc.expect {
+			t.Errorf("%s: expected %s: got %v", tc.input, tc.expect, err)
+		}
+	}
+}
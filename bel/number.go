@@ -0,0 +1,272 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// Bel's numbers are complex numbers whose real and imaginary parts
+// are signed rationals. The Bel source builds them out of lists, which
+// is far too slow to use, so we represent them natively with big.Rat.
+// The big.Rat values in a number are never modified once created.
+
+// rzero and rone are shared constants. Do not modify them.
+var (
+	rzero = big.NewRat(0, 1)
+	rone  = big.NewRat(1, 1)
+)
+
+// mknumber creates a new NUMBER cell
+func mknumber(re, im *big.Rat) *cell {
+	return &cell{
+		_flag: bfNumber,
+		_object: object{
+			_number: number{
+				_real: re,
+				_imag: im,
+			},
+		},
+	}
+}
+
+// mkint creates a new NUMBER cell for an integer
+func mkint(n int64) *cell {
+	return mknumber(big.NewRat(n, 1), rzero)
+}
+
+// numr returns the real part of a NUMBER
+func numr(a *cell) *big.Rat {
+	return a._object._number._real
+}
+
+// numi returns the imaginary part of a NUMBER
+func numi(a *cell) *big.Rat {
+	return a._object._number._imag
+}
+
+// isreal returns true if the cell is a NUMBER with no imaginary part
+func isreal(a *cell) bool {
+	return isnumber(a) && numi(a).Sign() == 0
+}
+
+// isint returns true if the cell is a real NUMBER with no fractional part
+func isint(a *cell) bool {
+	return isreal(a) && numr(a).IsInt()
+}
+
+// numadd returns x + y
+func numadd(x, y *cell) *cell {
+	return mknumber(new(big.Rat).Add(numr(x), numr(y)), new(big.Rat).Add(numi(x), numi(y)))
+}
+
+// numsub returns x - y
+func numsub(x, y *cell) *cell {
+	return mknumber(new(big.Rat).Sub(numr(x), numr(y)), new(big.Rat).Sub(numi(x), numi(y)))
+}
+
+// nummul returns x * y
+func nummul(x, y *cell) *cell {
+	xr, xi, yr, yi := numr(x), numi(x), numr(y), numi(y)
+	re := new(big.Rat).Sub(new(big.Rat).Mul(xr, yr), new(big.Rat).Mul(xi, yi))
+	im := new(big.Rat).Add(new(big.Rat).Mul(xi, yr), new(big.Rat).Mul(xr, yi))
+	return mknumber(re, im)
+}
+
+// numdiv returns x / y
+func numdiv(x, y *cell) (*cell, error) {
+	yr, yi := numr(y), numi(y)
+	d := new(big.Rat).Add(new(big.Rat).Mul(yr, yr), new(big.Rat).Mul(yi, yi))
+	if d.Sign() == 0 {
+		return nil, errors.New("divide-by-zero")
+	}
+	// multiply x by the reciprocal of y, which is (yr - yi i) / d
+	recip := mknumber(new(big.Rat).Quo(yr, d), new(big.Rat).Quo(new(big.Rat).Neg(yi), d))
+	return nummul(x, recip), nil
+}
+
+// numeq returns true if x and y are the same number
+func numeq(x, y *cell) bool {
+	return numr(x).Cmp(numr(y)) == 0 && numi(x).Cmp(numi(y)) == 0
+}
+
+// numless returns true if x < y.
+// Only real numbers can be compared.
+func numless(x, y *cell) (bool, error) {
+	if !isreal(x) || !isreal(y) {
+		return false, errors.New("incomparable")
+	}
+	return numr(x).Cmp(numr(y)) < 0, nil
+}
+
+// parsenum returns a NUMBER cell, or nil if the text isn't a number.
+// It follows parsenum in pgdocs/bel.bel, so it accepts integers,
+// decimals, ratios, and complex numbers like 3+4i, for base 10.
+func parsenum(text string) (*cell, error) {
+	if validi(text) {
+		im, err := parsei(text)
+		if err != nil {
+			return nil, err
+		}
+		return mknumber(rzero, im), nil
+	}
+	sign, rest := "", text
+	if signc(text) {
+		sign, rest = text[:1], text[1:]
+	}
+	ds, es := rest, ""
+	if i := strings.IndexAny(rest, "+-"); i != -1 {
+		ds, es = rest[:i], rest[i:]
+	}
+	if !validr(ds) || (es != "" && !validi(es)) {
+		return nil, nil
+	}
+	re, err := parsesr(sign + ds)
+	if err != nil {
+		return nil, err
+	}
+	im := rzero
+	if es != "" {
+		if im, err = parsei(es); err != nil {
+			return nil, err
+		}
+	}
+	return mknumber(re, im), nil
+}
+
+// signc returns true if the text starts with a sign
+func signc(text string) bool {
+	return strings.HasPrefix(text, "+") || strings.HasPrefix(text, "-")
+}
+
+// validi returns true if the text is an imaginary number like +4i or -i
+func validi(text string) bool {
+	if len(text) < 2 || !signc(text) || !strings.HasSuffix(text, "i") {
+		return false
+	}
+	digs := text[1 : len(text)-1]
+	return digs == "" || validr(digs)
+}
+
+// validr returns true if the text is an unsigned decimal or ratio
+func validr(text string) bool {
+	if validd(text) {
+		return true
+	}
+	i := strings.IndexByte(text, '/')
+	return i != -1 && validd(text[:i]) && validd(text[i+1:])
+}
+
+// validd returns true if the text is unsigned digits with at most one decimal point
+func validd(text string) bool {
+	digits, dots := 0, 0
+	for _, ch := range text {
+		if '0' <= ch && ch <= '9' {
+			digits++
+		} else if ch == '.' {
+			dots++
+		} else {
+			return false
+		}
+	}
+	return digits != 0 && dots < 2
+}
+
+// parsei returns the value of an imaginary number
+func parsei(text string) (*big.Rat, error) {
+	if len(text) > 2 {
+		return parsesr(text[:len(text)-1])
+	} else if text[0] == '+' {
+		return rone, nil
+	}
+	return big.NewRat(-1, 1), nil
+}
+
+// parsesr returns the value of a signed decimal or ratio
+func parsesr(text string) (*big.Rat, error) {
+	neg := strings.HasPrefix(text, "-")
+	text = strings.TrimLeft(text, "+-")
+	n, d := text, "1"
+	if i := strings.IndexByte(text, '/'); i != -1 {
+		n, d = text[:i], text[i+1:]
+	}
+	r, err := parsed(n)
+	if err != nil {
+		return nil, err
+	}
+	rd, err := parsed(d)
+	if err != nil {
+		return nil, err
+	} else if rd.Sign() == 0 {
+		return nil, errors.New("zero-denominator")
+	}
+	r.Quo(r, rd)
+	if neg {
+		r.Neg(r)
+	}
+	return r, nil
+}
+
+// parsed returns the value of unsigned digits with an optional decimal point
+func parsed(text string) (*big.Rat, error) {
+	if !validd(text) {
+		return nil, errors.New("bad-number")
+	}
+	i, f := text, ""
+	if n := strings.IndexByte(text, '.'); n != -1 {
+		i, f = text[:n], text[n+1:]
+	}
+	num, ok := new(big.Int).SetString("0"+i+f, 10)
+	if !ok {
+		return nil, errors.New("bad-number")
+	}
+	den := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(len(f))), nil)
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// prnum returns the printed representation of a number.
+// The real part is omitted if it is zero and the imaginary part isn't,
+// and an imaginary part of one is printed as just the sign.
+func prnum(a *cell) string {
+	re, im := numr(a), numi(a)
+	var sb strings.Builder
+	if re.Sign() != 0 || im.Sign() == 0 {
+		sb.WriteString(re.RatString())
+	}
+	if im.Sign() != 0 {
+		if im.Sign() < 0 {
+			sb.WriteByte('-')
+		} else {
+			sb.WriteByte('+')
+		}
+		if abs := new(big.Rat).Abs(im); abs.Cmp(rone) != 0 {
+			sb.WriteString(abs.RatString())
+		}
+		sb.WriteByte('i')
+	}
+	return sb.String()
+}
@@ -0,0 +1,124 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseNum(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		expect string // empty if the text isn't a number
+	}{
+		{"0", "0"},
+		{"-17", "-17"},
+		{"+17", "17"},
+		{"2.5", "5/2"},
+		{".05", "1/20"},
+		{"1.", "1"},
+		{"19/20", "19/20"},
+		{"-6/4", "-3/2"},
+		{"1.5/3", "1/2"},
+		{"3+4i", "3+4i"},
+		{"3-4i", "3-4i"},
+		{"-1/2+i", "-1/2+i"},
+		{"+i", "+i"},
+		{"-2.5i", "-5/2i"},
+		{"0+0i", "0"},
+		{"", ""},
+		{".", ""},
+		{"a", ""},
+		{"1a", ""},
+		{"1/2/3", ""},
+		{"1..2", ""},
+		{"3+4", ""},
+		{"3+4j", ""},
+		{"i", ""},
+		{"+-1", ""},
+	} {
+		n, err := parsenum(tc.input)
+		if err != nil {
+			t.Errorf("%q: %v", tc.input, err)
+		} else if n == nil && tc.expect != "" {
+			t.Errorf("%q: expected %s: got not a number", tc.input, tc.expect)
+		} else if n != nil && tc.expect == "" {
+			t.Errorf("%q: expected not a number: got %s", tc.input, prnum(n))
+		} else if n != nil && prnum(n) != tc.expect {
+			t.Errorf("%q: expected %s: got %s", tc.input, tc.expect, prnum(n))
+		}
+	}
+
+	for _, input := range []string{"1/0", "1/0.0", "2+3/0i"} {
+		if _, err := parsenum(input); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+	for _, input := range []string{"", ".", "1.2.3", "-1", "1e3"} {
+		if _, err := parsed(input); err == nil {
+			t.Errorf("parsed %q: expected error", input)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{"(+)", "0"},
+		{"(+ 1/3 1/6)", "1/2"},
+		{"(+ .1 .2)", "3/10"},
+		{"(- 5)", "-5"},
+		{"(- 1 1/2 1/3)", "1/6"},
+		{"(* 2/3 3/4)", "1/2"},
+		{"(* 3+4i 3-4i)", "25"},
+		{"(* +i +i)", "-1"},
+		{"(/ 2)", "2"},
+		{"(/ 1 3 3)", "1/9"},
+		{"(/ 1 +i)", "-i"},
+		{"(/ 3+4i 1-2i)", "-1+2i"},
+		{"(+ 123456789012345678901234567890 1)", "123456789012345678901234567891"},
+		{"(< 1/3 1/2 2)", "t"},
+		{"(< 1/2 1/3)", "nil"},
+		{"(> 2.5 5/2)", "nil"},
+		{"(> 3 2 1)", "t"},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+		} else if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+
+	for _, input := range []string{"(/ 1 0)", "(/ 1 0+0i)", "(< 1 +i)", "(+ 1 'a)"} {
+		if _, err := vm.Eval(context.Background(), input); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
@@ -41,7 +41,55 @@ const (
 	opcError0 // print initial error string
 	opcError1 // print remainder of error
 	opcReadSExpr
+	opcReadList  // add element to list being read
+	opcReadDot   // read the cdr of a dotted list
+	opcReadWrap  // wrap quote, bquote, comma, or comma-at around expression
+	opcReadLabel // fill in the pair for a #n= label
 	opcP0List
 	opcP1List
+	opcEval   // evaluate the expression in code
+	opcE0Args // start evaluating the arguments of a call
+	opcE1Args // add the value to the arguments and evaluate the next one
+	opcApply  // apply the function in code to args
+	opcQuote
+	opcIf0 // start the clauses of an if
+	opcIf1 // evaluate the next test
+	opcIf2 // choose a branch based on the value of the test
+	opcSet0
+	opcSet1 // evaluate the value for the next place
+	opcSet2 // assign the value to the place
+	opcDef
+	opcFn
+	opcDo0         // start the expressions of a do
+	opcDo1         // evaluate the next expression of a do
+	opcPass        // bind the next parameter of a closure
+	opcTypeCheck   // bind a parameter if the type check passed
+	opcPassDefault // bind an optional parameter to its default
+	opcMac
+	opcMacro
+	opcMacEval // evaluate the expansion of a macro call
+	opcExpand  // expand a macro call
+	opcExpand1 // expand the result of expanding a macro call
+	opcCcc     // call a function with the current continuation
+	opcDyn0    // evaluate the value for a dynamic binding
+	opcDyn1    // evaluate the body with the dynamic binding
+	opcErr     // signal an error
+	opcOnerr0  // evaluate an expression with err bound to a handler
+	opcOnerr1  // evaluate the alternative if the expression signalled an error
+	opcSafe
+	opcSet3      // assign the value to the location found for the place
+	opcWhere0    // evaluate an expression for its location
+	opcWhere1    // marks the expression whose location is wanted
+	opcWhere2    // return the location found
+	opcAfter0    // evaluate the first expression of an after
+	opcAfter1    // evaluate the second expression of an after
+	opcAfter2    // return the value of the first expression
+	opcAfter3    // evaluate the second expression of an after being unwound
+	opcReadPrim0 // start reading for the read primitive
+	opcReadPrim  // marks a read for the read primitive
+	opcBquote
+	opcLoad0 // read the next expression of a loaded file
+	opcLoad1 // evaluate the expression read from a loaded file
+	opcHalt  // return the value to the caller of eval
 	opcInvalid
 )
@@ -16,14 +16,62 @@ func _() {
 	_ = x[opcError0-5]
 	_ = x[opcError1-6]
 	_ = x[opcReadSExpr-7]
-	_ = x[opcP0List-8]
-	_ = x[opcP1List-9]
-	_ = x[opcInvalid-10]
+	_ = x[opcReadList-8]
+	_ = x[opcReadDot-9]
+	_ = x[opcReadWrap-10]
+	_ = x[opcReadLabel-11]
+	_ = x[opcP0List-12]
+	_ = x[opcP1List-13]
+	_ = x[opcEval-14]
+	_ = x[opcE0Args-15]
+	_ = x[opcE1Args-16]
+	_ = x[opcApply-17]
+	_ = x[opcQuote-18]
+	_ = x[opcIf0-19]
+	_ = x[opcIf1-20]
+	_ = x[opcIf2-21]
+	_ = x[opcSet0-22]
+	_ = x[opcSet1-23]
+	_ = x[opcSet2-24]
+	_ = x[opcDef-25]
+	_ = x[opcFn-26]
+	_ = x[opcDo0-27]
+	_ = x[opcDo1-28]
+	_ = x[opcPass-29]
+	_ = x[opcTypeCheck-30]
+	_ = x[opcPassDefault-31]
+	_ = x[opcMac-32]
+	_ = x[opcMacro-33]
+	_ = x[opcMacEval-34]
+	_ = x[opcExpand-35]
+	_ = x[opcExpand1-36]
+	_ = x[opcCcc-37]
+	_ = x[opcDyn0-38]
+	_ = x[opcDyn1-39]
+	_ = x[opcErr-40]
+	_ = x[opcOnerr0-41]
+	_ = x[opcOnerr1-42]
+	_ = x[opcSafe-43]
+	_ = x[opcSet3-44]
+	_ = x[opcWhere0-45]
+	_ = x[opcWhere1-46]
+	_ = x[opcWhere2-47]
+	_ = x[opcAfter0-48]
+	_ = x[opcAfter1-49]
+	_ = x[opcAfter2-50]
+	_ = x[opcAfter3-51]
+	_ = x[opcReadPrim0-52]
+	_ = x[opcReadPrim-53]
+	_ = x[opcBquote-54]
+	_ = x[opcLoad0-55]
+	_ = x[opcLoad1-56]
+	_ = x[opcHalt-57]
+	_ = x[opcInvalid-58]
 }
 
-const _opcode_name = "opcLoadopcTopLevel0opcTopLevel1opcReadopcValuePrintopcError0opcError1opcReadSExpropcP0ListopcP1ListopcInvalid"
+const _opcode_name = "opcLoadopcTopLevel0opcTopLevel1opcReadopcValuePrintopcError0opcError1opcReadSExpropcReadListopcReadDotopcReadWrapopcReadLabelopcP0ListopcP1ListopcEvalopcE0ArgsopcE1ArgsopcApplyopcQuoteopcIf0opcIf1opcIf2opcSet0opcSet1opcSet2opcDefopcFnopcDo0opcDo1opcPassopcTypeCheckopcPassDefaultopcMacopcMacroopcMacEvalopcExpandopcExpand1opcCccopcDyn0opcDyn1opcErropcOnerr0opcOnerr1opcSafeopcSet3opcWhere0opcWhere1opcWhere2opcAfter0opcAfter1opcAfter2opcAfter3opcReadPrim0opcReadPrimopcBquoteopcLoad0opcLoad1opcHaltopcInvalid"
 
-var _opcode_index = [...]uint8{0, 7, 19, 31, 38, 51, 60, 69, 81, 90, 99, 109}
+var _opcode_index = [...]uint16{0, 7, 19, 31, 38, 51, 60, 69, 81, 92, 102, 113, 125, 134, 143, 150, 159, 168, 176, 184, 190, 196, 202, 209, 216, 223, 229, 234, 240, 246, 253, 265, 279, 285, 293, 303, 312, 322, 328, 335, 342, 348, 357, 366, 373, 380, 389, 398, 407, 416, 425, 434, 443, 455, 466, 475, 483, 491, 498, 508}
 
 func (i opcode) String() string {
 	if i < 0 || i >= opcode(len(_opcode_index)-1) {
@@ -0,0 +1,217 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	_ "embed" // for the prelude
+	"fmt"
+	"io"
+	"strings"
+)
+
+// prelude is the Bel source that every VM loads when it starts.
+//
+//go:embed prelude.bel
+var prelude string
+
+// overridden are the names of prelude definitions that the VM skips.
+// Names bound to primitives and special forms are skipped as well.
+// Most of these are implemented natively. The rest belong to the
+// evaluator in the prelude, which the VM replaces entirely.
+var overridden = map[string]bool{
+	// the evaluator
+	"vmark": true, "bel": true, "mev": true, "sched": true, "ev": true,
+	"vref": true, "smark": true, "inwhere": true, "lookup": true,
+	"binding": true, "sigerr": true, "fu": true, "evmark": true,
+	"formfn": true, "parameters": true,
+	"if2": true, "dyn2": true, "evcall": true, "evcall2": true,
+	"applym": true, "applyf": true, "applylit": true, "okenv": true,
+	"okstack": true, "okparms": true, "oktoparm": true, "prims": true,
+	"applyprim": true, "applyclo": true, "pass": true,
+	"typecheck": true, "destructure": true, "applycont": true,
+	"protected": true,
+	// numbers
+	"i0": true, "i<": true, "i+": true, "i-": true, "i*": true,
+	"i/": true, "i^": true, "r+": true, "r-": true, "r*": true,
+	"r/": true, "srzero": true, "sr+": true, "sr-": true, "srinv": true,
+	"sr*": true, "sr/": true, "srrecip": true, "sr<": true,
+	"srnum": true, "c+": true, "c*": true, "litnum": true, "numr": true,
+	"simplify": true, "factor": true, "common": true, "buildnum": true,
+	// the reader
+	"cbuf": true, "saferead": true, "rdex": true, "eatwhite": true,
+	"charstil": true, "rdlist": true,
+	"rddot": true, "hard-rdex": true, "namecs": true, "rdwrap": true,
+	"rddelim": true, "rdtarget": true, "rdword": true, "parseword": true,
+	"parsenum": true, "validi": true, "validr": true, "validd": true,
+	"parsei": true, "parsesr": true, "parsed": true, "parseint": true,
+	"charint": true, "parset": true, "parseslist": true,
+	"parsecom": true, "parseno": true,
+	// the printer
+	"namedups": true, "cells": true, "prc": true, "ustring": true,
+	"prstring": true, "presc": true, "prsimple": true, "prsymbol": true,
+	"prnum": true, "rrep": true, "irep": true, "intchar": true,
+	"prpair": true, "prelts": true, "prnice": true,
+}
+
+// skipped are the prelude definitions that the VM skips without
+// implementing, and why. The tables let programs extend the prelude's
+// evaluator, reader, and comparisons. The VM's special forms, virtual
+// functions, locations, syntax, and comparisons are built in, so it
+// skips the forms that fill the tables as native.
+var skipped = map[string]string{
+	"forms": "special forms can't be added", "form": "special forms can't be added",
+	"virfns": "virtual functions can't be added", "vir": "virtual functions can't be added",
+	"locfns": "locations can't be added", "loc": "locations can't be added",
+	"comfns": "comparisons can't be added", "com": "comparisons can't be added",
+	"syntax": "syntax can't be added", "syn": "syntax can't be added",
+	"thread": "threads are not implemented",
+}
+
+// PreludeResult is the outcome of loading one top level form of the prelude.
+type PreludeResult struct {
+	Line   int    // line of the form in prelude.bel
+	Form   string // the operator of the form, e.g. def or mac
+	Name   string // the name that the form defines, if any
+	Status string // "ok", "native", "skipped", or "failed"
+	Err    string // the error, if the form failed, or why it was skipped
+}
+
+// Option configures a VM when it is created
+type Option func(*VM)
+
+// WithoutPrelude is an option that creates the VM without loading the prelude
+func WithoutPrelude() Option {
+	return func(vm *VM) {
+		vm.noPrelude = true
+	}
+}
+
+// PreludeReport returns the outcome of loading each top level form of
+// the prelude, in the order that they appear.
+func (vm *VM) PreludeReport() []PreludeResult {
+	return vm.preludeResults
+}
+
+// WritePreludeReport writes a line for each top level form of the prelude,
+// followed by the number of forms that loaded, were native, were skipped,
+// or failed.
+func (vm *VM) WritePreludeReport(w io.Writer) error {
+	counts := map[string]int{}
+	for _, r := range vm.preludeResults {
+		counts[r.Status]++
+		line := fmt.Sprintf("%5d %-7s %-5s %s", r.Line, r.Status, r.Form, r.Name)
+		if r.Err != "" {
+			line += ": " + r.Err
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line, " ")); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "ok %d, native %d, skipped %d, failed %d\n", counts["ok"], counts["native"], counts["skipped"], counts["failed"])
+	return err
+}
+
+// loadPrelude evaluates each top level form of the prelude, skipping
+// the ones that are implemented natively, and records the outcome.
+func (vm *VM) loadPrelude() {
+	vm.pushReader("prelude.bel", strings.NewReader(prelude))
+	defer vm.popReader()
+	// the limits are for programs, not the prelude
+	limits := vm.limits
+	vm.limits = Limits{}
+	defer func() { vm.limits = limits }()
+
+	for {
+		form, err := vm.readForm()
+		if err == io.EOF {
+			return
+		}
+		r := PreludeResult{Line: vm.global.position.Line}
+		if err != nil {
+			r.Status, r.Err = "failed", err.Error()
+			vm.preludeResults = append(vm.preludeResults, r)
+			return
+		}
+		if ispair(form) && issymbol(car(form)) {
+			r.Form = symbolName(car(form))
+			if name := nth(form, 1); issymbol(name) {
+				r.Name = symbolName(name)
+			} else {
+				r.Name = name.String()
+			}
+		}
+		if reason := vm.skip(form); reason != "" {
+			r.Status, r.Err = "skipped", reason
+		} else if vm.native(form) {
+			r.Status = "native"
+		} else if _, err := vm.evalForm(form); err != nil {
+			r.Status, r.Err = "failed", err.Error()
+		} else {
+			r.Status = "ok"
+		}
+		vm.preludeResults = append(vm.preludeResults, r)
+	}
+}
+
+// skip returns the reason that the VM skips the definition
+// without implementing it, or the empty string if it doesn't
+func (vm *VM) skip(form *cell) string {
+	if !ispair(form) || !issymbol(nth(form, 1)) {
+		return ""
+	}
+	switch symbolName(car(form)) {
+	case "def", "form", "mac", "set":
+		return skipped[symbolName(nth(form, 1))]
+	}
+	return ""
+}
+
+// native returns true if the VM implements the definition natively
+func (vm *VM) native(form *cell) bool {
+	if !ispair(form) {
+		return false
+	}
+	switch symbolName(car(form)) {
+	case "com", "form", "loc", "syn", "vir":
+		// these fill tables that belong to the prelude's evaluator,
+		// and the VM has the entries built in
+		return true
+	case "def", "mac", "set":
+	default:
+		return false
+	}
+	name := nth(form, 1)
+	if !issymbol(name) {
+		return false
+	} else if overridden[symbolName(name)] {
+		return true
+	} else if _, ok := vm.forms[name]; ok {
+		return true
+	} else if b, ok := vm.globe[name]; ok {
+		v := cdr(b)
+		return ispair(v) && car(v) == vm._LIT && nth(v, 1) == vm._PRIM
+	}
+	return false
+}
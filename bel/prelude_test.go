@@ -0,0 +1,67 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPreludeReport(t *testing.T) {
+	vm := NewVM(nil)
+	status := map[string]string{}
+	for _, r := range vm.PreludeReport() {
+		status[r.Form+" "+r.Name] = r.Status
+		if r.Status == "failed" {
+			t.Errorf("%d: %s %s: %s", r.Line, r.Form, r.Name, r.Err)
+		}
+	}
+	for _, tc := range []struct {
+		form   string
+		expect string
+	}{
+		{"def no", "ok"},
+		{"def append", "native"},
+		{"vir tab", "native"},
+		{"vir arr", "native"},
+		{"loc (isa 'tab)", "native"},
+		{"form thread", "skipped"},
+		{"def com", "skipped"},
+		{"mac syn", "skipped"},
+	} {
+		if got := status[tc.form]; got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.form, tc.expect, got)
+		}
+	}
+
+	var sb bytes.Buffer
+	if err := vm.WritePreludeReport(&sb); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "  400 skipped form  thread: threads are not implemented\n") {
+		t.Errorf("report: expected thread to be skipped: got %q", sb.String())
+	}
+}
@@ -0,0 +1,304 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+)
+
+// primitive is a Bel function implemented in Go.
+type primitive struct {
+	name  string
+	arity int // maximum number of arguments, or -1 if there is no limit
+	fn    func(vm *VM, args []*cell) (*cell, error)
+}
+
+// primitives are the functions that every VM starts with.
+var primitives = []*primitive{
+	{name: "id", arity: 2, fn: primId},
+	{name: "join", arity: 2, fn: primJoin},
+	{name: "car", arity: 1, fn: primCar},
+	{name: "cdr", arity: 1, fn: primCdr},
+	{name: "type", arity: 1, fn: primType},
+	{name: "xar", arity: 2, fn: primXar},
+	{name: "xdr", arity: 2, fn: primXdr},
+	{name: "sym", arity: 1, fn: primSym},
+	{name: "nom", arity: 1, fn: primNom},
+	{name: "coin", arity: 0, fn: primCoin},
+	{name: "+", arity: -1, fn: primAdd},
+	{name: "-", arity: -1, fn: primSub},
+	{name: "*", arity: -1, fn: primMul},
+	{name: "/", arity: -1, fn: primDiv},
+	{name: "<", arity: -1, fn: primLess},
+	{name: ">", arity: -1, fn: primGreater},
+}
+
+// extensions are primitives that are not part of Bel
+var extensions = []*primitive{
+	{name: "char-bits", arity: 1, fn: primCharBits},
+	{name: "bits-char", arity: 1, fn: primBitsChar},
+	{name: "json-read", arity: 3, fn: primJSONRead},
+	{name: "json-write", arity: 3, fn: primJSONWrite},
+}
+
+// applyprim calls a primitive with a list of arguments.
+// Missing arguments default to nil, as they do in Bel.
+func (vm *VM) applyprim(p *primitive, args *cell) (*cell, error) {
+	var argv []*cell
+	for ; ispair(args); args = cdr(args) {
+		argv = append(argv, car(args))
+	}
+	if p.arity >= 0 {
+		if len(argv) > p.arity {
+			return nil, errors.New("overargs")
+		}
+		for len(argv) < p.arity {
+			argv = append(argv, _NIL)
+		}
+	}
+	return p.fn(vm, argv)
+}
+
+// truth converts a Go bool into t or nil
+func truth(b bool) *cell {
+	if b {
+		return _TRUE
+	}
+	return _NIL
+}
+
+// primId implements (id x y).
+// Like Bel, it compares by identity, not by value.
+func primId(vm *VM, args []*cell) (*cell, error) {
+	return truth(args[0] == args[1]), nil
+}
+
+// primJoin implements (join x y)
+func primJoin(vm *VM, args []*cell) (*cell, error) {
+	return vm.cons(args[0], args[1]), nil
+}
+
+// primCar implements (car x).
+// The car of nil is nil; the car of any other atom is an error.
+func primCar(vm *VM, args []*cell) (*cell, error) {
+	if args[0] == _NIL {
+		return _NIL, nil
+	} else if !ispair(args[0]) {
+		return nil, errors.New("car-on-atom")
+	}
+	return car(args[0]), nil
+}
+
+// primCdr implements (cdr x).
+// The cdr of nil is nil; the cdr of any other atom is an error.
+func primCdr(vm *VM, args []*cell) (*cell, error) {
+	if args[0] == _NIL {
+		return _NIL, nil
+	} else if !ispair(args[0]) {
+		return nil, errors.New("cdr-on-atom")
+	}
+	return cdr(args[0]), nil
+}
+
+// primType implements (type x).
+// Numbers are a native type here, so their type is num.
+func primType(vm *VM, args []*cell) (*cell, error) {
+	switch x := args[0]; {
+	case issymbol(x):
+		return vm._SYMBOL, nil
+	case ischar(x):
+		return vm._CHAR, nil
+	case isnumber(x):
+		return vm._NUM, nil
+	case isstream(x):
+		return vm._STREAM, nil
+	case ispair(x) || isstring(x):
+		return vm._PAIR, nil
+	}
+	return nil, errors.New("unknown-type")
+}
+
+// primXar implements (xar x y), which replaces the car of x with y
+func primXar(vm *VM, args []*cell) (*cell, error) {
+	if !ispair(args[0]) {
+		return nil, errors.New("xar-on-atom")
+	}
+	setcar(args[0], args[1])
+	return args[1], nil
+}
+
+// primXdr implements (xdr x y), which replaces the cdr of x with y
+func primXdr(vm *VM, args []*cell) (*cell, error) {
+	if !ispair(args[0]) {
+		return nil, errors.New("xdr-on-atom")
+	}
+	setcdr(args[0], args[1])
+	return args[1], nil
+}
+
+// primSym implements (sym x), which returns the symbol named by a string
+func primSym(vm *VM, args []*cell) (*cell, error) {
+	if !isstring(args[0]) {
+		return nil, errors.New("mistype")
+	}
+	return vm.intern(asstring(args[0])), nil
+}
+
+// primNom implements (nom x), which returns the name of a symbol as a string
+func primNom(vm *VM, args []*cell) (*cell, error) {
+	if !issymbol(args[0]) {
+		return nil, errors.New("mistype")
+	}
+	return vm.chars(symbolName(args[0])), nil
+}
+
+// primCoin implements (coin), which returns t or nil at random
+func primCoin(vm *VM, args []*cell) (*cell, error) {
+	return truth(rand.Intn(2) == 0), nil
+}
+
+// numbers returns an error unless every argument is a number
+func numbers(args []*cell) error {
+	for _, arg := range args {
+		if !isnumber(arg) {
+			return errors.New("mistype")
+		}
+	}
+	return nil
+}
+
+// primAdd implements (+ ns)
+func primAdd(vm *VM, args []*cell) (*cell, error) {
+	if err := numbers(args); err != nil {
+		return nil, err
+	}
+	sum := mkint(0)
+	for _, arg := range args {
+		if err := vm.charge(sum, arg); err != nil {
+			return nil, err
+		}
+		sum = numadd(sum, arg)
+	}
+	return sum, nil
+}
+
+// primSub implements (- ns).
+// With one argument, it returns the negation.
+func primSub(vm *VM, args []*cell) (*cell, error) {
+	if err := numbers(args); err != nil {
+		return nil, err
+	} else if len(args) == 0 {
+		return mkint(0), nil
+	} else if len(args) == 1 {
+		return numsub(mkint(0), args[0]), nil
+	}
+	diff := args[0]
+	for _, arg := range args[1:] {
+		if err := vm.charge(diff, arg); err != nil {
+			return nil, err
+		}
+		diff = numsub(diff, arg)
+	}
+	return diff, nil
+}
+
+// primMul implements (* ns)
+func primMul(vm *VM, args []*cell) (*cell, error) {
+	if err := numbers(args); err != nil {
+		return nil, err
+	}
+	product := mkint(1)
+	for _, arg := range args {
+		if err := vm.charge(product, arg); err != nil {
+			return nil, err
+		}
+		product = nummul(product, arg)
+	}
+	return product, nil
+}
+
+// primDiv implements (/ ns).
+// Like Bel, it divides the first argument by the product of the rest,
+// so with one argument it returns that argument.
+func primDiv(vm *VM, args []*cell) (*cell, error) {
+	if err := numbers(args); err != nil {
+		return nil, err
+	} else if len(args) == 0 {
+		return mkint(1), nil
+	}
+	divisor, err := primMul(vm, args[1:])
+	if err != nil {
+		return nil, err
+	} else if err := vm.charge(args[0], divisor); err != nil {
+		return nil, err
+	}
+	return numdiv(args[0], divisor)
+}
+
+// primLess implements (< args).
+// It returns t if each argument is less than the next.
+func primLess(vm *VM, args []*cell) (*cell, error) {
+	for i := 1; i < len(args); i++ {
+		if less, err := binless(args[i-1], args[i]); err != nil {
+			return nil, err
+		} else if !less {
+			return _NIL, nil
+		}
+	}
+	return _TRUE, nil
+}
+
+// primGreater implements (> args).
+// It returns t if each argument is greater than the next.
+func primGreater(vm *VM, args []*cell) (*cell, error) {
+	for i := 1; i < len(args); i++ {
+		if less, err := binless(args[i], args[i-1]); err != nil {
+			return nil, err
+		} else if !less {
+			return _NIL, nil
+		}
+	}
+	return _TRUE, nil
+}
+
+// binless returns true if x < y.
+// Like bin< in the Bel source, it compares reals, chars,
+// strings, and symbols, in that order of preference.
+func binless(x, y *cell) (bool, error) {
+	if x == _NIL && y == _NIL {
+		return false, nil
+	} else if isreal(x) && isreal(y) {
+		return numless(x, y)
+	} else if ischar(x) && ischar(y) {
+		return aschar(x) < aschar(y), nil
+	} else if isstring(x) && isstring(y) {
+		return strings.Compare(asstring(x), asstring(y)) < 0, nil
+	} else if issymbol(x) && issymbol(y) {
+		return strings.Compare(symbolName(x), symbolName(y)) < 0, nil
+	}
+	return false, errors.New("incomparable")
+}
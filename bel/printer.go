@@ -0,0 +1,201 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The printer turns cells into text that the reader can read back.
+// The names of the functions follow the printer in pgdocs/bel.bel.
+
+// prsymbol returns the printed representation of a symbol.
+// Names that wouldn't read back as the same symbol are delimited
+// by broken bars, with any bars or backslashes in the name escaped.
+func prsymbol(name string) string {
+	if !oddsym(name) {
+		return name
+	}
+	return "¦" + presc(name, '¦') + "¦"
+}
+
+// presc escapes the delimiter and backslashes in the text
+func presc(text string, esc rune) string {
+	var sb strings.Builder
+	for _, ch := range text {
+		if ch == esc || ch == '\\' {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(ch)
+	}
+	return sb.String()
+}
+
+// prchar returns the printed representation of a character,
+// which is a backslash followed by the character.
+func prchar(r rune) string {
+	return "\\" + string(r)
+}
+
+// prstring returns the printed representation of a string
+func prstring(text string) string {
+	return "\"" + presc(text, '"') + "\""
+}
+
+// prsimple returns the printed representation of an atom
+func prsimple(a *cell) string {
+	if issymbol(a) {
+		return prsymbol(symbolName(a))
+	} else if ischar(a) {
+		return prchar(aschar(a))
+	} else if isstream(a) {
+		return "<stream>"
+	} else if iscontinuation(a) {
+		return "<continuation>"
+	} else if isnumber(a) {
+		return prnum(a)
+	} else if isstring(a) {
+		return prstring(asstring(a))
+	}
+	return "<unknown>"
+}
+
+// printer holds the state needed to print one object.
+type printer struct {
+	labels map[*cell]int // labels for pairs that occur more than once
+	next   int           // the number of labels that have been printed
+}
+
+// newPrinter returns a printer for the object.
+// Every pair that occurs more than once in the object is given a label.
+// The label is numbered when it is first printed, so the numbers ascend
+// in the order that they appear in the text.
+func newPrinter(a *cell) *printer {
+	p := &printer{labels: map[*cell]int{}}
+	seen := map[*cell]bool{}
+	for stack := []*cell{a}; len(stack) != 0; {
+		a, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		if !ispair(a) {
+			continue
+		} else if seen[a] {
+			p.labels[a] = 0
+			continue
+		}
+		seen[a] = true
+		stack = append(stack, cdr(a), car(a))
+	}
+	return p
+}
+
+// labeled returns true if the pair has a label
+func (p *printer) labeled(a *cell) bool {
+	_, ok := p.labels[a]
+	return ok
+}
+
+// label returns the text for a labeled pair and numbers it if needed.
+// The first time the pair is printed, the text is the target, #n=.
+// After that it is the reference, #n.
+func (p *printer) label(a *cell) (text string, first bool) {
+	if n := p.labels[a]; n != 0 {
+		return fmt.Sprintf("#%d", n), false
+	}
+	p.next++
+	p.labels[a] = p.next
+	return fmt.Sprintf("#%d=", p.next), true
+}
+
+// ustring returns true if the object can be printed as a string.
+// That is, it is a non-empty string and none of its pairs are labeled.
+// Labels are checked first. A circular list always has a labeled
+// pair, so the walk stops when it reaches it.
+func (p *printer) ustring(a *cell) bool {
+	if a == _NIL || !ispair(a) {
+		return false
+	}
+	for ; ispair(a); a = cdr(a) {
+		if p.labeled(a) || !ischar(car(a)) {
+			return false
+		}
+	}
+	return a == _NIL
+}
+
+// abbrev returns the abbreviation for quote, bquote, comma and comma-at
+// forms, or the empty string if the object can't be abbreviated.
+func (p *printer) abbrev(a *cell) string {
+	if !ispair(a) || !ispair(cdr(a)) || cdr(cdr(a)) != _NIL || p.labeled(cdr(a)) || !issymbol(car(a)) {
+		return ""
+	}
+	switch symbolName(car(a)) {
+	case "quote":
+		return "'"
+	case "bquote":
+		return "`"
+	case "comma":
+		return ","
+	case "comma-at":
+		return ",@"
+	}
+	return ""
+}
+
+// sprint writes the printed representation of an object.
+// It follows the same steps as the opcP0List and opcP1List op codes.
+func (p *printer) sprint(sb *strings.Builder, a *cell) {
+	if !ispair(a) {
+		sb.WriteString(prsimple(a))
+		return
+	} else if p.labeled(a) {
+		text, first := p.label(a)
+		sb.WriteString(text)
+		if !first {
+			return
+		} else if ischar(car(a)) && p.ustring(cdr(a)) {
+			sb.WriteString(prstring(asstring(a)))
+			return
+		}
+	} else if p.ustring(a) {
+		sb.WriteString(prstring(asstring(a)))
+		return
+	} else if prefix := p.abbrev(a); prefix != "" {
+		sb.WriteString(prefix)
+		p.sprint(sb, car(cdr(a)))
+		return
+	}
+	sb.WriteString("(")
+	p.sprint(sb, car(a))
+	for rest := cdr(a); rest != _NIL; rest = cdr(rest) {
+		if !ispair(rest) || p.labeled(rest) || p.ustring(rest) {
+			sb.WriteString(" . ")
+			p.sprint(sb, rest)
+			break
+		}
+		sb.WriteString(" ")
+		p.sprint(sb, car(rest))
+	}
+	sb.WriteString(")")
+}
@@ -0,0 +1,74 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPrintCircular(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	for _, tc := range []struct {
+		input  string
+		expect string
+	}{
+		{`'#1=(\a . #1)`, `#1=(\a . #1)`},
+		{`'#1=(\a \b . #1)`, `#1=(\a \b . #1)`},
+		{`'(\x . #1=(\a \b . #1))`, `(\x . #1=(\a \b . #1))`},
+		{`'(#1="ab" #1)`, `(#1="ab" #1)`},
+		{`'(\a . #1=(\b))`, `"ab"`},
+		{`'#1=(a #1)`, `#1=(a #1)`},
+		{`'(#2=(2) #1=(1) #1 #2)`, `(#1=(2) #2=(1) #2 #1)`},
+		{`'(#2=(b #1=(a)) #1 #2)`, `(#1=(b #2=(a)) #2 #1)`},
+	} {
+		v, err := vm.Eval(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+			continue
+		}
+		if got := v.String(); got != tc.expect {
+			t.Errorf("%s: expected %s: got %s", tc.input, tc.expect, got)
+		}
+	}
+}
+
+func TestValuePrint(t *testing.T) {
+	// the print op codes must agree with cell.String
+	out := &bytes.Buffer{}
+	vm := NewVM(nil, WithoutPrelude(), WithIO(strings.NewReader(""), out, ioutil.Discard))
+	input := `'#1=(\a . #1)` + "\n" + `'(#1="ab" #1)` + "\n" + `'(a 'b)` + "\n" + `'(#2=(2) #1=(1) #1 #2)` + "\n"
+	if err := vm.Interact(strings.NewReader(input), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{`#1=(\a . #1)`, `(#1="ab" #1)`, `(a 'b)`, `(#1=(2) #2=(1) #2 #1)`} {
+		if !strings.Contains(out.String(), "bel> "+expect+"\n") {
+			t.Errorf("expected %s: got %q", expect, out.String())
+		}
+	}
+}
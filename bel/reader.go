@@ -0,0 +1,224 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// The reader turns the text of atoms into cells.
+// The names of the functions follow the reader in pgdocs/bel.bel.
+
+// namecs are the names of characters that have them
+var namecs = map[string]rune{
+	"bel": '\a',
+	"tab": '\t',
+	"lf":  '\n',
+	"cr":  '\r',
+	"sp":  ' ',
+}
+
+// mklist creates a proper list from the cells.
+func mklist(elts ...*cell) *cell {
+	list := _NIL
+	for i := len(elts) - 1; i >= 0; i-- {
+		list = mkpair(elts[i], list)
+	}
+	return list
+}
+
+// nth returns the nth element of a list, counting from zero.
+// It returns nil if the list is too short.
+func nth(list *cell, n int) *cell {
+	for ; n > 0 && ispair(list); n-- {
+		list = cdr(list)
+	}
+	if !ispair(list) {
+		return _NIL
+	}
+	return car(list)
+}
+
+// reverse returns the list reversed and terminated with tail.
+// It allocates new pairs, so it is safe to use on shared lists.
+func reverse(list, tail *cell) *cell {
+	for ; ispair(list); list = cdr(list) {
+		tail = mkpair(car(list), tail)
+	}
+	return tail
+}
+
+// rdatom converts the text of a tkATOM token into a cell.
+func (vm *VM) rdatom(text string) (*cell, error) {
+	if strings.HasPrefix(text, "\\") {
+		return rdchar(text[1:])
+	} else if strings.HasPrefix(text, "¦") && strings.HasSuffix(text, "¦") && len(text) > len("¦") {
+		return vm.intern(strings.TrimSuffix(strings.TrimPrefix(text, "¦"), "¦")), nil
+	}
+	return vm.parseword(text)
+}
+
+// rdchar converts the text following a backslash into a character.
+// The text is either a single character or the name of one.
+func rdchar(text string) (*cell, error) {
+	if text == "" {
+		return nil, errors.New("escape-without-char")
+	} else if utf8.RuneCountInString(text) == 1 {
+		r, _ := utf8.DecodeRuneInString(text)
+		return mkchar(r), nil
+	} else if r, ok := namecs[text]; ok {
+		return mkchar(r), nil
+	}
+	return nil, errors.New("unknown-named-char")
+}
+
+// parseword returns a number, a symbol, or the expansion of
+// symbols joined by intrasymbol characters.
+func (vm *VM) parseword(text string) (*cell, error) {
+	if n, err := parsenum(text); err != nil || n != nil {
+		return n, err
+	} else if text == "." {
+		return nil, errors.New("unexpected-dot")
+	} else if strings.ContainsRune(text, '|') {
+		return vm.parset(text)
+	} else if strings.ContainsAny(text, ".!") {
+		return vm.parseslist(text)
+	}
+	return vm.parsecom(text)
+}
+
+// parset expands a type spec like x|symbol into (t x symbol).
+func (vm *VM) parset(text string) (*cell, error) {
+	if strings.Count(text, "|") > 1 {
+		return nil, errors.New("multiple-bars")
+	}
+	vt := tokens(text, '|')
+	if len(vt) != 2 {
+		return nil, errors.New("bad-tspec")
+	}
+	v, err := vm.parseword(vt[0])
+	if err != nil {
+		return nil, err
+	}
+	t, err := vm.parseword(vt[1])
+	if err != nil {
+		return nil, err
+	}
+	return vm.list(_TRUE, v, t), nil
+}
+
+// parseslist expands a.b into (a b) and a!b into (a 'b).
+// A leading intrasymbol character implies upon, so .a is (upon a).
+func (vm *VM) parseslist(text string) (*cell, error) {
+	var rs []string
+	for _, ch := range text {
+		intrac := ch == '.' || ch == '!'
+		if n := len(rs); n != 0 && (strings.ContainsAny(rs[n-1], ".!") == intrac) {
+			rs[n-1] += string(ch)
+		} else {
+			rs = append(rs, string(ch))
+		}
+	}
+	if strings.ContainsAny(rs[len(rs)-1], ".!") {
+		return nil, errors.New("final-intrasymbol")
+	}
+	if strings.ContainsAny(rs[0], ".!") {
+		rs = append([]string{".", "upon"}, rs...)
+	} else {
+		rs = append([]string{"."}, rs...)
+	}
+	var elts []*cell
+	for i := 0; i < len(rs); i += 2 {
+		op, word := rs[i], rs[i+1]
+		if len(op) > 1 {
+			return nil, errors.New("double-intrasymbol")
+		}
+		elt, err := vm.parsecom(word)
+		if err != nil {
+			return nil, err
+		}
+		if op == "!" {
+			elt = vm.list(vm.intern("quote"), elt)
+		}
+		elts = append(elts, elt)
+	}
+	return vm.list(elts...), nil
+}
+
+// parsecom expands a:b into (compose a b).
+func (vm *VM) parsecom(text string) (*cell, error) {
+	if !strings.ContainsRune(text, ':') {
+		return vm.parseno(text)
+	}
+	elts := []*cell{vm.intern("compose")}
+	for _, word := range tokens(text, ':') {
+		elt, err := vm.parseno(word)
+		if err != nil {
+			return nil, err
+		}
+		elts = append(elts, elt)
+	}
+	return vm.list(elts...), nil
+}
+
+// parseno expands ~a into (compose no a).
+func (vm *VM) parseno(text string) (*cell, error) {
+	if strings.HasPrefix(text, "~") {
+		if text == "~" {
+			return vm.intern("no"), nil
+		}
+		a, err := vm.parseno(text[1:])
+		if err != nil {
+			return nil, err
+		}
+		return vm.list(vm.intern("compose"), vm.intern("no"), a), nil
+	} else if n, err := parsenum(text); err != nil || n != nil {
+		return n, err
+	}
+	return vm.intern(text), nil
+}
+
+// oddsym returns true if the name of a symbol would not read back as
+// that symbol, so the printer must delimit it with broken bars.
+func oddsym(name string) bool {
+	if n, err := parsenum(name); name == "" || n != nil || err != nil {
+		return true
+	}
+	for i, ch := range name {
+		if isbreak(ch) || strings.ContainsRune("|.!:", ch) {
+			return true
+		} else if i == 0 && strings.ContainsRune("\\¦#~", ch) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokens splits the text on the separator, dropping empty tokens.
+func tokens(text string, sep rune) []string {
+	return strings.FieldsFunc(text, func(ch rune) bool { return ch == sep })
+}
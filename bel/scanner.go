@@ -24,12 +24,43 @@
 
 package bel
 
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// token is a single lexeme from the input stream.
+// line and col are 1-based and mark the first character of the token.
 type token struct {
-	k tokenKind
+	k    tokenKind
+	text string
+	line int
+	col  int
 }
 
 type tokenKind int
 
+// Position is the location of a token in a named input.
+// Lines and columns start at 1.
+type Position struct {
+	Name string
+	Line int
+	Col  int
+}
+
+// String returns the position as name:line:col, or an empty string
+// if there is no position.
+func (p Position) String() string {
+	if p.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d:%d", p.Name, p.Line, p.Col)
+}
+
 const (
 	tkEOF tokenKind = iota
 	tkLPAREN
@@ -45,11 +76,251 @@ const (
 	tkSHARP
 )
 
-type scanner struct{}
+func (k tokenKind) String() string {
+	switch k {
+	case tkEOF:
+		return "eof"
+	case tkLPAREN:
+		return "lparen"
+	case tkRPAREN:
+		return "rparen"
+	case tkDOT:
+		return "dot"
+	case tkATOM:
+		return "atom"
+	case tkQUOTE:
+		return "quote"
+	case tkCOMMENT:
+		return "comment"
+	case tkDQUOTE:
+		return "dquote"
+	case tkBQUOTE:
+		return "bquote"
+	case tkCOMMA:
+		return "comma"
+	case tkATMARK:
+		return "atmark"
+	case tkSHARP:
+		return "sharp"
+	}
+	return fmt.Sprintf("tokenKind(%d)", int(k))
+}
+
+// scanner breaks an input stream into tokens.
+// It tracks the line and column of the next character to read.
+type scanner struct {
+	name string
+	r    io.RuneScanner
+	line int
+	col  int
+
+	// position before the last rune read, for unread
+	prevLine int
+	prevCol  int
+
+	dec *json.Decoder // created by the first json-read from the input
+}
+
+// jsonDecoder returns the decoder that json-read uses for the input.
+// It reads through the scanner's buffer, so input that the scanner
+// has buffered isn't lost, but it reads ahead itself, so an input
+// should be read with either read or json-read but not both.
+func (s *scanner) jsonDecoder() *json.Decoder {
+	if s.dec == nil {
+		// newScanner's argument was a reader, so r is one too
+		s.dec = json.NewDecoder(s.r.(io.Reader))
+		s.dec.UseNumber()
+	}
+	return s.dec
+}
+
+// newScanner returns a scanner that reads from r.
+// The name is used when reporting positions.
+func newScanner(name string, r io.Reader) *scanner {
+	rs, ok := r.(io.RuneScanner)
+	if !ok {
+		rs = bufio.NewReader(r)
+	}
+	return &scanner{name: name, r: rs, line: 1, col: 1}
+}
+
+// isbreak returns true if the rune ends an atom.
+// These are the white space characters and the characters
+// that Bel treats as syntax.
+func isbreak(ch rune) bool {
+	if unicode.IsSpace(ch) {
+		return true
+	}
+	switch ch {
+	case '(', ')', '[', ']', ';', '\'', '`', ',', '"':
+		return true
+	}
+	return false
+}
+
+// getc returns the next rune from the input.
+// It returns io.EOF at the end of input.
+func (s *scanner) getc() (rune, error) {
+	ch, _, err := s.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	s.prevLine, s.prevCol = s.line, s.col
+	if ch == '\n' {
+		s.line, s.col = s.line+1, 1
+	} else {
+		s.col++
+	}
+	return ch, nil
+}
+
+// ungetc pushes the last rune read back onto the input.
+// Only one rune may be pushed back.
+func (s *scanner) ungetc() {
+	if err := s.r.UnreadRune(); err == nil {
+		s.line, s.col = s.prevLine, s.prevCol
+	}
+}
+
+// peekc returns the next rune without consuming it.
+func (s *scanner) peekc() (rune, error) {
+	ch, err := s.getc()
+	if err != nil {
+		return 0, err
+	}
+	s.ungetc()
+	return ch, nil
+}
+
+// errorf returns an error annotated with the scanner's position.
+func (s *scanner) errorf(line, col int, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d:%d: %s", s.name, line, col, fmt.Sprintf(format, args...))
+}
 
+// nextToken returns the next token from the input.
+// White space is skipped.
+// Comments are returned as tkCOMMENT so that the reader can decide what to do with them.
+// At end of input, it returns a tkEOF token and a nil error.
 func (s *scanner) nextToken() (*token, error) {
 	if s == nil {
 		return &token{k: tkEOF}, nil
 	}
-	return &token{k: tkEOF}, nil
+
+	// skip white space
+	var ch rune
+	var err error
+	for {
+		if ch, err = s.getc(); err == io.EOF {
+			return &token{k: tkEOF, line: s.line, col: s.col}, nil
+		} else if err != nil {
+			return nil, s.errorf(s.line, s.col, "%v", err)
+		} else if !unicode.IsSpace(ch) {
+			break
+		}
+	}
+
+	t := &token{line: s.prevLine, col: s.prevCol, text: string(ch)}
+	switch ch {
+	case '(', '[':
+		t.k = tkLPAREN
+	case ')', ']':
+		t.k = tkRPAREN
+	case '\'':
+		t.k = tkQUOTE
+	case '`':
+		t.k = tkBQUOTE
+	case ',':
+		if next, err := s.peekc(); err == nil && next == '@' {
+			_, _ = s.getc()
+			t.k, t.text = tkATMARK, ",@"
+		} else {
+			t.k = tkCOMMA
+		}
+	case ';':
+		t.k, t.text = tkCOMMENT, s.readUntil(func(ch rune) bool { return ch == '\n' })
+	case '"':
+		t.k = tkDQUOTE
+		if t.text, err = s.readDelimited('"'); err != nil {
+			return nil, s.errorf(t.line, t.col, "string: %v", err)
+		}
+	case '#':
+		// labels for shared structure are #n and #n=
+		t.k = tkSHARP
+		t.text = "#" + s.readUntil(func(ch rune) bool { return !('0' <= ch && ch <= '9') })
+		if next, err := s.peekc(); err == nil && next == '=' {
+			_, _ = s.getc()
+			t.text += "="
+		}
+	case '.':
+		// a dot followed by a break is the dot in a dotted pair.
+		// otherwise, it is the start of an atom like .5 or .a
+		if next, err := s.peekc(); err == io.EOF || (err == nil && isbreak(next)) {
+			t.k = tkDOT
+		} else {
+			t.k, t.text = tkATOM, "."+s.readUntil(isbreak)
+		}
+	case '\\':
+		// characters are atoms that start with a backslash.
+		// if the next character is a break, it is the character.
+		next, err := s.getc()
+		if err == io.EOF {
+			return nil, s.errorf(t.line, t.col, "escape without char")
+		} else if err != nil {
+			return nil, s.errorf(t.line, t.col, "%v", err)
+		}
+		t.k, t.text = tkATOM, "\\"+string(next)
+		if !isbreak(next) {
+			t.text += s.readUntil(isbreak)
+		}
+	case '¦':
+		// symbols with odd names are delimited by broken bars
+		t.k = tkATOM
+		text, err := s.readDelimited('¦')
+		if err != nil {
+			return nil, s.errorf(t.line, t.col, "symbol: %v", err)
+		}
+		t.text = "¦" + text + "¦"
+	default:
+		t.k, t.text = tkATOM, string(ch)+s.readUntil(isbreak)
+	}
+
+	return t, nil
+}
+
+// readUntil consumes runes up to, but not including, the first one that
+// satisfies the stop function or the end of input.
+func (s *scanner) readUntil(stop func(rune) bool) string {
+	var sb strings.Builder
+	for {
+		ch, err := s.getc()
+		if err != nil {
+			return sb.String()
+		} else if stop(ch) {
+			s.ungetc()
+			return sb.String()
+		}
+		sb.WriteRune(ch)
+	}
+}
+
+// readDelimited consumes runes up to the closing delimiter, which is discarded.
+// A backslash causes the following rune to be taken literally.
+func (s *scanner) readDelimited(delim rune) (string, error) {
+	var sb strings.Builder
+	for escaped := false; ; {
+		ch, err := s.getc()
+		if err == io.EOF {
+			return sb.String(), fmt.Errorf("missing delimiter")
+		} else if err != nil {
+			return sb.String(), err
+		} else if escaped {
+			escaped = false
+		} else if ch == '\\' {
+			escaped = true
+			continue
+		} else if ch == delim {
+			return sb.String(), nil
+		}
+		sb.WriteRune(ch)
+	}
 }
@@ -0,0 +1,268 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNextToken(t *testing.T) {
+	// the inputs are taken from pgdocs/belexamples.txt
+	for _, tc := range []struct {
+		id     int
+		input  string
+		expect []token
+	}{
+		{id: 1,
+			input: "(cons 'a 'b '(c d e))",
+			expect: []token{
+				{k: tkLPAREN, text: "(", line: 1, col: 1},
+				{k: tkATOM, text: "cons", line: 1, col: 2},
+				{k: tkQUOTE, text: "'", line: 1, col: 7},
+				{k: tkATOM, text: "a", line: 1, col: 8},
+				{k: tkQUOTE, text: "'", line: 1, col: 10},
+				{k: tkATOM, text: "b", line: 1, col: 11},
+				{k: tkQUOTE, text: "'", line: 1, col: 13},
+				{k: tkLPAREN, text: "(", line: 1, col: 14},
+				{k: tkATOM, text: "c", line: 1, col: 15},
+				{k: tkATOM, text: "d", line: 1, col: 17},
+				{k: tkATOM, text: "e", line: 1, col: 19},
+				{k: tkRPAREN, text: ")", line: 1, col: 20},
+				{k: tkRPAREN, text: ")", line: 1, col: 21},
+			}},
+		{id: 2,
+			input: `(cons \h "ello")`,
+			expect: []token{
+				{k: tkLPAREN, text: "(", line: 1, col: 1},
+				{k: tkATOM, text: "cons", line: 1, col: 2},
+				{k: tkATOM, text: `\h`, line: 1, col: 7},
+				{k: tkDQUOTE, text: "ello", line: 1, col: 10},
+				{k: tkRPAREN, text: ")", line: 1, col: 16},
+			}},
+		{id: 3,
+			input: "(+ .05 19/20)",
+			expect: []token{
+				{k: tkLPAREN, text: "(", line: 1, col: 1},
+				{k: tkATOM, text: "+", line: 1, col: 2},
+				{k: tkATOM, text: ".05", line: 1, col: 4},
+				{k: tkATOM, text: "19/20", line: 1, col: 8},
+				{k: tkRPAREN, text: ")", line: 1, col: 13},
+			}},
+		{id: 4,
+			input: "(let x 'a\n    (cons x 'b))",
+			expect: []token{
+				{k: tkLPAREN, text: "(", line: 1, col: 1},
+				{k: tkATOM, text: "let", line: 1, col: 2},
+				{k: tkATOM, text: "x", line: 1, col: 6},
+				{k: tkQUOTE, text: "'", line: 1, col: 8},
+				{k: tkATOM, text: "a", line: 1, col: 9},
+				{k: tkLPAREN, text: "(", line: 2, col: 5},
+				{k: tkATOM, text: "cons", line: 2, col: 6},
+				{k: tkATOM, text: "x", line: 2, col: 11},
+				{k: tkQUOTE, text: "'", line: 2, col: 13},
+				{k: tkATOM, text: "b", line: 2, col: 14},
+				{k: tkRPAREN, text: ")", line: 2, col: 15},
+				{k: tkRPAREN, text: ")", line: 2, col: 16},
+			}},
+		{id: 5,
+			input: "(let ((x y) . z) '((a b) c) (list x y z))",
+			expect: []token{
+				{k: tkLPAREN, text: "(", line: 1, col: 1},
+				{k: tkATOM, text: "let", line: 1, col: 2},
+				{k: tkLPAREN, text: "(", line: 1, col: 6},
+				{k: tkLPAREN, text: "(", line: 1, col: 7},
+				{k: tkATOM, text: "x", line: 1, col: 8},
+				{k: tkATOM, text: "y", line: 1, col: 10},
+				{k: tkRPAREN, text: ")", line: 1, col: 11},
+				{k: tkDOT, text: ".", line: 1, col: 13},
+				{k: tkATOM, text: "z", line: 1, col: 15},
+				{k: tkRPAREN, text: ")", line: 1, col: 16},
+				{k: tkQUOTE, text: "'", line: 1, col: 18},
+				{k: tkLPAREN, text: "(", line: 1, col: 19},
+				{k: tkLPAREN, text: "(", line: 1, col: 20},
+				{k: tkATOM, text: "a", line: 1, col: 21},
+				{k: tkATOM, text: "b", line: 1, col: 23},
+				{k: tkRPAREN, text: ")", line: 1, col: 24},
+				{k: tkATOM, text: "c", line: 1, col: 26},
+				{k: tkRPAREN, text: ")", line: 1, col: 27},
+				{k: tkLPAREN, text: "(", line: 1, col: 29},
+				{k: tkATOM, text: "list", line: 1, col: 30},
+				{k: tkATOM, text: "x", line: 1, col: 35},
+				{k: tkATOM, text: "y", line: 1, col: 37},
+				{k: tkATOM, text: "z", line: 1, col: 39},
+				{k: tkRPAREN, text: ")", line: 1, col: 40},
+				{k: tkRPAREN, text: ")", line: 1, col: 41},
+			}},
+		{id: 6,
+			input: "((macro (v) `(set ,v 7)) x)",
+			expect: []token{
+				{k: tkLPAREN, text: "(", line: 1, col: 1},
+				{k: tkLPAREN, text: "(", line: 1, col: 2},
+				{k: tkATOM, text: "macro", line: 1, col: 3},
+				{k: tkLPAREN, text: "(", line: 1, col: 9},
+				{k: tkATOM, text: "v", line: 1, col: 10},
+				{k: tkRPAREN, text: ")", line: 1, col: 11},
+				{k: tkBQUOTE, text: "`", line: 1, col: 13},
+				{k: tkLPAREN, text: "(", line: 1, col: 14},
+				{k: tkATOM, text: "set", line: 1, col: 15},
+				{k: tkCOMMA, text: ",", line: 1, col: 19},
+				{k: tkATOM, text: "v", line: 1, col: 20},
+				{k: tkATOM, text: "7", line: 1, col: 22},
+				{k: tkRPAREN, text: ")", line: 1, col: 23},
+				{k: tkRPAREN, text: ")", line: 1, col: 24},
+				{k: tkATOM, text: "x", line: 1, col: 26},
+				{k: tkRPAREN, text: ")", line: 1, col: 27},
+			}},
+		{id: 7,
+			input: "(mac pop (place)\n  `(let (cell loc) (where ,place)\n     ,@xs))",
+			expect: []token{
+				{k: tkLPAREN, text: "(", line: 1, col: 1},
+				{k: tkATOM, text: "mac", line: 1, col: 2},
+				{k: tkATOM, text: "pop", line: 1, col: 6},
+				{k: tkLPAREN, text: "(", line: 1, col: 10},
+				{k: tkATOM, text: "place", line: 1, col: 11},
+				{k: tkRPAREN, text: ")", line: 1, col: 16},
+				{k: tkBQUOTE, text: "`", line: 2, col: 3},
+				{k: tkLPAREN, text: "(", line: 2, col: 4},
+				{k: tkATOM, text: "let", line: 2, col: 5},
+				{k: tkLPAREN, text: "(", line: 2, col: 9},
+				{k: tkATOM, text: "cell", line: 2, col: 10},
+				{k: tkATOM, text: "loc", line: 2, col: 15},
+				{k: tkRPAREN, text: ")", line: 2, col: 18},
+				{k: tkLPAREN, text: "(", line: 2, col: 20},
+				{k: tkATOM, text: "where", line: 2, col: 21},
+				{k: tkCOMMA, text: ",", line: 2, col: 27},
+				{k: tkATOM, text: "place", line: 2, col: 28},
+				{k: tkRPAREN, text: ")", line: 2, col: 33},
+				{k: tkATMARK, text: ",@", line: 3, col: 6},
+				{k: tkATOM, text: "xs", line: 3, col: 8},
+				{k: tkRPAREN, text: ")", line: 3, col: 10},
+				{k: tkRPAREN, text: ")", line: 3, col: 11},
+			}},
+		{id: 8,
+			input: "(map ++:y '(a b)) y!b ((fn (x|symbol) (cons x 'b)) 'a)",
+			expect: []token{
+				{k: tkLPAREN, text: "(", line: 1, col: 1},
+				{k: tkATOM, text: "map", line: 1, col: 2},
+				{k: tkATOM, text: "++:y", line: 1, col: 6},
+				{k: tkQUOTE, text: "'", line: 1, col: 11},
+				{k: tkLPAREN, text: "(", line: 1, col: 12},
+				{k: tkATOM, text: "a", line: 1, col: 13},
+				{k: tkATOM, text: "b", line: 1, col: 15},
+				{k: tkRPAREN, text: ")", line: 1, col: 16},
+				{k: tkRPAREN, text: ")", line: 1, col: 17},
+				{k: tkATOM, text: "y!b", line: 1, col: 19},
+				{k: tkLPAREN, text: "(", line: 1, col: 23},
+				{k: tkLPAREN, text: "(", line: 1, col: 24},
+				{k: tkATOM, text: "fn", line: 1, col: 25},
+				{k: tkLPAREN, text: "(", line: 1, col: 28},
+				{k: tkATOM, text: "x|symbol", line: 1, col: 29},
+				{k: tkRPAREN, text: ")", line: 1, col: 37},
+				{k: tkLPAREN, text: "(", line: 1, col: 39},
+				{k: tkATOM, text: "cons", line: 1, col: 40},
+				{k: tkATOM, text: "x", line: 1, col: 45},
+				{k: tkQUOTE, text: "'", line: 1, col: 47},
+				{k: tkATOM, text: "b", line: 1, col: 48},
+				{k: tkRPAREN, text: ")", line: 1, col: 49},
+				{k: tkRPAREN, text: ")", line: 1, col: 50},
+				{k: tkQUOTE, text: "'", line: 1, col: 52},
+				{k: tkATOM, text: "a", line: 1, col: 53},
+				{k: tkRPAREN, text: ")", line: 1, col: 54},
+			}},
+		{id: 9,
+			input: "(set x '(a #1=(b) #1 c)) ; shared structure",
+			expect: []token{
+				{k: tkLPAREN, text: "(", line: 1, col: 1},
+				{k: tkATOM, text: "set", line: 1, col: 2},
+				{k: tkATOM, text: "x", line: 1, col: 6},
+				{k: tkQUOTE, text: "'", line: 1, col: 8},
+				{k: tkLPAREN, text: "(", line: 1, col: 9},
+				{k: tkATOM, text: "a", line: 1, col: 10},
+				{k: tkSHARP, text: "#1=", line: 1, col: 12},
+				{k: tkLPAREN, text: "(", line: 1, col: 15},
+				{k: tkATOM, text: "b", line: 1, col: 16},
+				{k: tkRPAREN, text: ")", line: 1, col: 17},
+				{k: tkSHARP, text: "#1", line: 1, col: 19},
+				{k: tkATOM, text: "c", line: 1, col: 22},
+				{k: tkRPAREN, text: ")", line: 1, col: 23},
+				{k: tkRPAREN, text: ")", line: 1, col: 24},
+				{k: tkCOMMENT, text: " shared structure", line: 1, col: 26},
+			}},
+		{id: 10,
+			input: `[f _ \(] '¦foo bar¦ "a\"b" \sp`,
+			expect: []token{
+				{k: tkLPAREN, text: "[", line: 1, col: 1},
+				{k: tkATOM, text: "f", line: 1, col: 2},
+				{k: tkATOM, text: "_", line: 1, col: 4},
+				{k: tkATOM, text: `\(`, line: 1, col: 6},
+				{k: tkRPAREN, text: "]", line: 1, col: 8},
+				{k: tkQUOTE, text: "'", line: 1, col: 10},
+				{k: tkATOM, text: "¦foo bar¦", line: 1, col: 11},
+				{k: tkDQUOTE, text: `a"b`, line: 1, col: 21},
+				{k: tkATOM, text: `\sp`, line: 1, col: 28},
+			}},
+	} {
+		s := newScanner("test", strings.NewReader(tc.input))
+		for i, expect := range append(tc.expect, token{k: tkEOF}) {
+			got, err := s.nextToken()
+			if err != nil {
+				t.Fatalf("%d: token %d: unexpected error %+v", tc.id, i+1, err)
+			}
+			if got.k != expect.k {
+				t.Fatalf("%d: token %d: kind: expected %s: got %s", tc.id, i+1, expect.k, got.k)
+			}
+			if expect.k == tkEOF {
+				break
+			}
+			if got.text != expect.text {
+				t.Errorf("%d: token %d: text: expected %q: got %q", tc.id, i+1, expect.text, got.text)
+			}
+			if got.line != expect.line || got.col != expect.col {
+				t.Errorf("%d: token %d: position: expected %d:%d: got %d:%d", tc.id, i+1, expect.line, expect.col, got.line, got.col)
+			}
+		}
+	}
+}
+
+func TestNextTokenErrors(t *testing.T) {
+	for _, tc := range []struct {
+		id    int
+		input string
+	}{
+		{id: 1, input: `(cons \h "ello`},
+		{id: 2, input: `'¦foo bar`},
+		{id: 3, input: `\`},
+	} {
+		s := newScanner("test", strings.NewReader(tc.input))
+		var err error
+		for tok := (&token{k: tkLPAREN}); err == nil && tok.k != tkEOF; {
+			tok, err = s.nextToken()
+		}
+		if err == nil {
+			t.Errorf("%d: expected error: got nil", tc.id)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// EventKind is the kind of a trace event
+type EventKind int
+
+const (
+	TraceDispatch EventKind = iota // the VM is about to execute an op code
+	TraceAlloc                     // the VM allocated a pair
+	TracePush                      // the VM pushed a frame
+	TracePop                       // the VM popped a frame
+	TraceError                     // the VM signalled an error
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case TraceDispatch:
+		return "dispatch"
+	case TraceAlloc:
+		return "alloc"
+	case TracePush:
+		return "push"
+	case TracePop:
+		return "pop"
+	case TraceError:
+		return "error"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is a single step in the evaluation of a program.
+type Event struct {
+	Kind  EventKind
+	Step  int    // the number of op codes executed so far
+	Depth int    // the number of frames on the stack
+	Op    string // the op code dispatched, or of the frame pushed or popped
+	Value string // the args dispatched, the pair allocated, or the error
+}
+
+// Tracer receives events from a VM.
+// Tracing is expensive, since every event prints the cells involved.
+type Tracer interface {
+	Trace(e Event)
+}
+
+// WithTracer is an option that sends events to t while the VM is
+// created and while it runs. Use SetTracer to trace only later work.
+func WithTracer(t Tracer) Option {
+	return func(vm *VM) {
+		vm.tracer = t
+	}
+}
+
+// SetTracer sends events to t. A nil tracer turns tracing off.
+func (vm *VM) SetTracer(t Tracer) {
+	vm.tracer = t
+}
+
+// trace sends an event to the tracer, if there is one
+func (vm *VM) trace(kind EventKind, op opcode, value *cell) {
+	if vm.tracer == nil {
+		return
+	}
+	e := Event{Kind: kind, Step: vm.steps, Depth: len(vm.frames.stack)}
+	if kind != TraceAlloc && kind != TraceError {
+		e.Op = op.String()
+	}
+	if value != nil {
+		e.Value = value.String()
+	}
+	vm.tracer.Trace(e)
+}
+
+// cons returns a new pair and reports the allocation to the tracer.
+// Every pair that a program causes the VM to create comes from cons,
+// list, reverse, or chars, so that the cell limit counts it. The VM's
+// own structures and error reports use mkpair.
+func (vm *VM) cons(car, cdr *cell) *cell {
+	vm.cells++
+	p := mkpair(car, cdr)
+	if vm.tracer != nil {
+		vm.trace(TraceAlloc, opcInvalid, p)
+	}
+	return p
+}
+
+// list creates a proper list from the cells with cons
+func (vm *VM) list(elts ...*cell) *cell {
+	list := _NIL
+	for i := len(elts) - 1; i >= 0; i-- {
+		list = vm.cons(elts[i], list)
+	}
+	return list
+}
+
+// reverse returns the elements of list in reverse order, followed
+// by tail, with cons
+func (vm *VM) reverse(list, tail *cell) *cell {
+	for ; ispair(list); list = cdr(list) {
+		tail = vm.cons(car(list), tail)
+	}
+	return tail
+}
+
+// chars creates a Bel string with cons
+func (vm *VM) chars(s string) *cell {
+	var rs []rune
+	for _, r := range s {
+		rs = append(rs, r)
+	}
+	list := _NIL
+	for i := len(rs) - 1; i >= 0; i-- {
+		list = vm.cons(mkchar(rs[i]), list)
+	}
+	return list
+}
+
+// textTracer writes events as lines of text
+type textTracer struct {
+	sync.Mutex
+	w io.Writer
+}
+
+// NewTextTracer returns a tracer that writes a line of text for each event.
+func NewTextTracer(w io.Writer) Tracer {
+	return &textTracer{w: w}
+}
+
+// Trace implements the Tracer interface
+func (t *textTracer) Trace(e Event) {
+	t.Lock()
+	defer t.Unlock()
+	line := fmt.Sprintf("%8d %3d %-8s %-14s %s", e.Step, e.Depth, e.Kind, e.Op, e.Value)
+	if e.Op == "" {
+		line = fmt.Sprintf("%8d %3d %-8s %s", e.Step, e.Depth, e.Kind, e.Value)
+	}
+	fmt.Fprintln(t.w, strings.TrimRight(line, " "))
+}
+
+// jsonTracer writes events as JSON objects, one per line
+type jsonTracer struct {
+	sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONTracer returns a tracer that writes each event as a line of JSON.
+func NewJSONTracer(w io.Writer) Tracer {
+	return &jsonTracer{enc: json.NewEncoder(w)}
+}
+
+// Trace implements the Tracer interface
+func (t *jsonTracer) Trace(e Event) {
+	t.Lock()
+	defer t.Unlock()
+	t.enc.Encode(struct {
+		Kind  string `json:"kind"`
+		Step  int    `json:"step"`
+		Depth int    `json:"depth"`
+		Op    string `json:"op,omitempty"`
+		Value string `json:"value,omitempty"`
+	}{e.Kind.String(), e.Step, e.Depth, e.Op, e.Value})
+}
@@ -0,0 +1,121 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTextTracer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	vm := NewVM(nil, WithoutPrelude())
+	vm.SetTracer(NewTextTracer(buf))
+	if _, err := vm.Eval(context.Background(), `(join 1 (car '(2)))`); err != nil {
+		t.Fatal(err)
+	}
+	vm.SetTracer(nil)
+	if _, err := vm.Eval(context.Background(), `(join 3 4)`); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			t.Fatalf("expected step, depth, and kind: got %q", line)
+		}
+		kinds[fields[2]]++
+	}
+	for _, kind := range []string{"dispatch", "alloc", "push", "pop"} {
+		if kinds[kind] == 0 {
+			t.Errorf("expected %s events: got none", kind)
+		}
+	}
+	if !strings.Contains(buf.String(), "alloc    (1 . 2)") {
+		t.Errorf("expected the allocation of (1 . 2)")
+	} else if strings.Contains(buf.String(), "(3 . 4)") {
+		t.Errorf("expected no events after the tracer is removed")
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	vm := NewVM(nil, WithoutPrelude(), WithTracer(NewJSONTracer(buf)))
+	if _, err := vm.Eval(context.Background(), `(car 'a)`); err == nil {
+		t.Fatal("expected error")
+	}
+
+	var events []map[string]interface{}
+	s := bufio.NewScanner(buf)
+	for s.Scan() {
+		var e map[string]interface{}
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatalf("%q: %v", s.Text(), err)
+		}
+		events = append(events, e)
+	}
+	var dispatched, errored bool
+	for _, e := range events {
+		switch e["kind"] {
+		case "dispatch":
+			dispatched = true
+			if _, ok := e["op"]; !ok {
+				t.Errorf("dispatch without op: %v", e)
+			}
+		case "error":
+			errored = true
+			if v, _ := e["value"].(string); !strings.HasPrefix(v, "(car-on-atom") {
+				t.Errorf("error: expected car-on-atom: got %q", v)
+			}
+		}
+	}
+	if !dispatched || !errored {
+		t.Errorf("expected dispatch and error events: got %d events", len(events))
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "bad.bel")
+	if err := os.WriteFile(name, []byte("(car 'a)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, errs := &bytes.Buffer{}, &bytes.Buffer{}
+	vm := NewVM([]string{name, filepath.Join(dir, "missing.bel")}, WithoutPrelude(), WithIO(strings.NewReader(""), out, errs))
+	vm.Run()
+	if out.Len() != 0 {
+		t.Errorf("output: expected nothing: got %q", out.String())
+	}
+	if got := errs.String(); !strings.Contains(got, "car-on-atom") || !strings.Contains(got, "cannot-open") {
+		t.Errorf("errors: expected car-on-atom and cannot-open: got %q", got)
+	}
+}
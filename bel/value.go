@@ -0,0 +1,270 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Value is a Bel object.
+// The zero Value is nil.
+type Value struct {
+	c *cell
+}
+
+// Nil is the empty list, which is also the symbol nil and false
+var Nil = Value{_NIL}
+
+// T is the symbol t, which is true
+var T = Value{_TRUE}
+
+// cell returns the cell for the value, treating the zero Value as nil
+func (v Value) cell() *cell {
+	if v.c == nil {
+		return _NIL
+	}
+	return v.c
+}
+
+// String returns the value as the printer would print it
+func (v Value) String() string {
+	return v.cell().String()
+}
+
+// IsNil returns true if the value is nil
+func (v Value) IsNil() bool {
+	return v.cell() == _NIL
+}
+
+// IsTrue returns true if the value is not nil, as Bel tests truth
+func (v Value) IsTrue() bool {
+	return v.cell() != _NIL
+}
+
+// IsSymbol returns true if the value is a symbol, including nil and t
+func (v Value) IsSymbol() bool {
+	return issymbol(v.cell())
+}
+
+// IsPair returns true if the value is a pair
+func (v Value) IsPair() bool {
+	return ispair(v.cell())
+}
+
+// IsChar returns true if the value is a character
+func (v Value) IsChar() bool {
+	return ischar(v.cell())
+}
+
+// IsStream returns true if the value is a stream
+func (v Value) IsStream() bool {
+	return isstream(v.cell())
+}
+
+// IsNumber returns true if the value is a number
+func (v Value) IsNumber() bool {
+	return isnumber(v.cell())
+}
+
+// IsString returns true if the value is a string.
+// Since a string is a list of characters, nil is the empty string.
+func (v Value) IsString() bool {
+	return isstring(v.cell())
+}
+
+// IsList returns true if the value is nil or a pair whose cdrs end in nil
+func (v Value) IsList() bool {
+	return proper(v.cell())
+}
+
+// Symbol returns the name of a symbol
+func (v Value) Symbol() (string, bool) {
+	if !v.IsSymbol() {
+		return "", false
+	}
+	return symbolName(v.cell()), true
+}
+
+// Car returns the first element of a pair, or nil if it isn't a pair
+func (v Value) Car() Value {
+	if !v.IsPair() {
+		return Nil
+	}
+	return Value{car(v.cell())}
+}
+
+// Cdr returns the rest of a pair, or nil if it isn't a pair
+func (v Value) Cdr() Value {
+	if !v.IsPair() {
+		return Nil
+	}
+	return Value{cdr(v.cell())}
+}
+
+// Char returns the rune of a character
+func (v Value) Char() (rune, bool) {
+	if !v.IsChar() {
+		return 0, false
+	}
+	return aschar(v.cell()), true
+}
+
+// Text returns the Go string for a string
+func (v Value) Text() (string, bool) {
+	if !v.IsString() {
+		return "", false
+	}
+	return asstring(v.cell()), true
+}
+
+// Int returns the value of an integer that fits in an int64
+func (v Value) Int() (int64, bool) {
+	if !isint(v.cell()) {
+		return 0, false
+	}
+	n := numr(v.cell()).Num()
+	return n.Int64(), n.IsInt64()
+}
+
+// Float returns the nearest float64 to a real number
+func (v Value) Float() (float64, bool) {
+	if !isreal(v.cell()) {
+		return 0, false
+	}
+	f, _ := numr(v.cell()).Float64()
+	return f, true
+}
+
+// Rat returns the real and imaginary parts of a number
+func (v Value) Rat() (re, im *big.Rat, ok bool) {
+	if !v.IsNumber() {
+		return nil, nil, false
+	}
+	return new(big.Rat).Set(numr(v.cell())), new(big.Rat).Set(numi(v.cell())), true
+}
+
+// Slice returns the elements of a list
+func (v Value) Slice() ([]Value, bool) {
+	if !v.IsList() {
+		return nil, false
+	}
+	var elts []Value
+	for a := v.cell(); ispair(a); a = cdr(a) {
+		elts = append(elts, Value{car(a)})
+	}
+	return elts, true
+}
+
+// Int returns a number for an integer
+func Int(n int64) Value {
+	return Value{mkint(n)}
+}
+
+// Float returns a number for a float. Bel numbers are exact, so the
+// result is the shortest decimal that rounds to the float, which makes
+// Float(0.1) the number 1/10. It returns nil for infinities and NaN.
+func Float(f float64) Value {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	if !ok {
+		return Nil
+	}
+	return Value{mknumber(r, rzero)}
+}
+
+// Char returns a character
+func Char(r rune) Value {
+	return Value{mkchar(r)}
+}
+
+// String returns a Bel string, which is a list of characters
+func String(s string) Value {
+	return Value{mkstring(s, true)}
+}
+
+// Cons returns a new pair
+func Cons(a, b Value) Value {
+	return Value{mkpair(a.cell(), b.cell())}
+}
+
+// List returns a list of the values
+func List(elts ...Value) Value {
+	list := _NIL
+	for i := len(elts) - 1; i >= 0; i-- {
+		list = mkpair(elts[i].cell(), list)
+	}
+	return Value{list}
+}
+
+// Symbol returns the symbol with the given name.
+// Symbols belong to a VM, so they can't be created without one.
+func (vm *VM) Symbol(name string) Value {
+	return Value{vm.intern(name)}
+}
+
+// Error is an error signalled by a Bel program that it did not handle.
+type Error struct {
+	Value     Value    // the error that was signalled, usually a symbol
+	Irritants Value    // a list of the objects that caused it
+	Position  Position // of the top level expression, if known
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	msg := []string{e.Value.String()}
+	if pos := e.Position.String(); pos != "" {
+		msg[0] = pos + ": " + msg[0]
+	}
+	for a := e.Irritants.cell(); ispair(a); a = cdr(a) {
+		msg = append(msg, car(a).String())
+	}
+	return strings.Join(msg, " ")
+}
+
+// Eval reads and evaluates every expression in src and returns the
+// value of the last one. It stops at the first error that the program
+// does not handle, which is returned as an *Error, or at the first
+// limit exceeded. If ctx is done first, it returns the context's error.
+func (vm *VM) Eval(ctx context.Context, src string) (Value, error) {
+	values, err := vm.ExecuteContext(ctx, []byte(src))
+	if err != nil || len(values) == 0 {
+		return Nil, err
+	}
+	return values[len(values)-1], nil
+}
+
+// EvalForm evaluates a form in the global environment.
+// Errors are returned as they are by Eval.
+func (vm *VM) EvalForm(ctx context.Context, form Value) (Value, error) {
+	vm.begin(ctx)
+	defer vm.begin(nil)
+	v, err := vm.evalForm(form.cell())
+	if err != nil {
+		return Nil, err
+	}
+	return Value{v}, nil
+}
@@ -0,0 +1,197 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package bel
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	eval := func(src string) Value {
+		v, err := vm.Eval(context.Background(), src)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+		return v
+	}
+
+	for _, tc := range []struct {
+		input                                     string
+		isNil, isSymbol, isPair, isChar, isNumber bool
+		isString, isList                          bool
+	}{
+		{input: `nil`, isNil: true, isSymbol: true, isString: true, isList: true},
+		{input: `t`, isSymbol: true},
+		{input: `'(a . b)`, isPair: true},
+		{input: `'(a b)`, isPair: true, isList: true},
+		{input: `"ab"`, isPair: true, isString: true, isList: true},
+		{input: `\a`, isChar: true},
+		{input: `3/4`, isNumber: true},
+		{input: `'#1=(a . #1)`, isPair: true},
+	} {
+		v := eval(tc.input)
+		for _, got := range []struct {
+			name      string
+			got, want bool
+		}{
+			{"IsNil", v.IsNil(), tc.isNil},
+			{"IsTrue", v.IsTrue(), !tc.isNil},
+			{"IsSymbol", v.IsSymbol(), tc.isSymbol},
+			{"IsPair", v.IsPair(), tc.isPair},
+			{"IsChar", v.IsChar(), tc.isChar},
+			{"IsNumber", v.IsNumber(), tc.isNumber},
+			{"IsString", v.IsString(), tc.isString},
+			{"IsList", v.IsList(), tc.isList},
+		} {
+			if got.got != got.want {
+				t.Errorf("%s: %s: expected %v: got %v", tc.input, got.name, got.want, got.got)
+			}
+		}
+	}
+
+	if s, ok := eval(`'abc`).Symbol(); !ok || s != "abc" {
+		t.Errorf("Symbol: expected abc: got %q %v", s, ok)
+	}
+	if v := eval(`'(a b)`); v.Car().String() != "a" || v.Cdr().String() != "(b)" {
+		t.Errorf("Car, Cdr: expected a (b): got %s %s", v.Car(), v.Cdr())
+	}
+	if v := eval(`'a`); !v.Car().IsNil() || !v.Cdr().IsNil() {
+		t.Errorf("Car, Cdr of an atom: expected nil nil: got %s %s", v.Car(), v.Cdr())
+	}
+	if r, ok := eval(`\λ`).Char(); !ok || r != 'λ' {
+		t.Errorf("Char: expected λ: got %q %v", r, ok)
+	}
+	if s, ok := eval(`"héllo"`).Text(); !ok || s != "héllo" {
+		t.Errorf("Text: expected héllo: got %q %v", s, ok)
+	}
+	if _, ok := eval(`'(\a b)`).Text(); ok {
+		t.Errorf("Text of a list of symbols: expected false")
+	}
+	if n, ok := eval(`-42`).Int(); !ok || n != -42 {
+		t.Errorf("Int: expected -42: got %d %v", n, ok)
+	}
+	if _, ok := eval(`123456789012345678901234567890`).Int(); ok {
+		t.Errorf("Int of a big integer: expected false")
+	}
+	if _, ok := eval(`1/2`).Int(); ok {
+		t.Errorf("Int of a fraction: expected false")
+	}
+	if f, ok := eval(`1/4`).Float(); !ok || f != 0.25 {
+		t.Errorf("Float: expected 0.25: got %v %v", f, ok)
+	}
+	if re, im, ok := eval(`1/2-3i`).Rat(); !ok || re.Cmp(big.NewRat(1, 2)) != 0 || im.Cmp(big.NewRat(-3, 1)) != 0 {
+		t.Errorf("Rat: expected 1/2 -3: got %v %v %v", re, im, ok)
+	}
+	if elts, ok := eval(`'(1 "a" \b)`).Slice(); !ok || len(elts) != 3 || elts[1].String() != `"a"` {
+		t.Errorf("Slice: expected [1 \"a\" \\b]: got %v %v", elts, ok)
+	}
+	if _, ok := eval(`'(1 . 2)`).Slice(); ok {
+		t.Errorf("Slice of a dotted list: expected false")
+	}
+
+	for _, tc := range []struct {
+		value  Value
+		expect string
+	}{
+		{Value{}, "nil"},
+		{Nil, "nil"},
+		{T, "t"},
+		{Int(-7), "-7"},
+		{Float(0.1), "1/10"},
+		{Char('x'), `\x`},
+		{String("hi"), `"hi"`},
+		{Cons(Int(1), Int(2)), "(1 . 2)"},
+		{List(vm.Symbol("a"), String("b"), List()), `(a "b" nil)`},
+	} {
+		if got := tc.value.String(); got != tc.expect {
+			t.Errorf("constructor: expected %s: got %s", tc.expect, got)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	ctx := context.Background()
+
+	// the value of the last expression is returned
+	if v, err := vm.Eval(ctx, `(set x 1) (join x 2)`); err != nil || v.String() != "(1 . 2)" {
+		t.Errorf("Eval: expected (1 . 2): got %s %v", v, err)
+	}
+	if v, err := vm.Eval(ctx, ``); err != nil || !v.IsNil() {
+		t.Errorf("Eval of nothing: expected nil: got %s %v", v, err)
+	}
+	// forms are evaluated in the same global environment
+	form := List(vm.Symbol("join"), vm.Symbol("x"), List(vm.Symbol("quote"), String("a")))
+	if v, err := vm.EvalForm(ctx, form); err != nil || v.String() != `(1 . "a")` {
+		t.Errorf("EvalForm: expected (1 . \"a\"): got %s %v", v, err)
+	}
+	if _, err := vm.EvalForm(ctx, List(vm.Symbol("car"), vm.Symbol("undefined"))); err == nil {
+		t.Errorf("EvalForm of an unbound variable: expected error")
+	}
+}
+
+func TestError(t *testing.T) {
+	vm := NewVM(nil, WithoutPrelude())
+	for _, tc := range []struct {
+		input     string
+		value     string
+		irritants string
+		position  Position
+		message   string
+	}{
+		{"1\n  (car 'a)", "car-on-atom", "((car a))", Position{"source.bel", 2, 3}, "source.bel:2:3: car-on-atom (car a)"},
+		{`(err 'boom 1 "x")`, "boom", `(1 "x")`, Position{"source.bel", 1, 1}, `source.bel:1:1: boom 1 "x"`},
+		{`(xyz)`, "unbound", "(xyz)", Position{"source.bel", 1, 1}, "source.bel:1:1: unbound xyz"},
+	} {
+		_, err := vm.Eval(context.Background(), tc.input)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: expected *Error: got %T %v", tc.input, err, err)
+			continue
+		}
+		if got := e.Value.String(); got != tc.value {
+			t.Errorf("%s: value: expected %s: got %s", tc.input, tc.value, got)
+		}
+		if got := e.Irritants.String(); got != tc.irritants {
+			t.Errorf("%s: irritants: expected %s: got %s", tc.input, tc.irritants, got)
+		}
+		if e.Position != tc.position {
+			t.Errorf("%s: position: expected %v: got %v", tc.input, tc.position, e.Position)
+		}
+		if got := e.Error(); got != tc.message {
+			t.Errorf("%s: message: expected %s: got %s", tc.input, tc.message, got)
+		}
+	}
+
+	// an error without a position has no prefix
+	e := &Error{Value: vm.Symbol("oops"), Irritants: List(Int(1))}
+	if got := e.Error(); got != "oops 1" {
+		t.Errorf("error without position: expected oops 1: got %s", got)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// editor reads lines from a terminal, letting the user edit the line
+// and recall earlier lines. It implements io.Reader so that the VM's
+// console reads from it like any other input. Each call that needs a
+// line puts the terminal in raw mode for as long as the line is edited,
+// so Ctrl-C still interrupts an evaluation.
+//
+// The keys are the usual ones: left and right arrows or Ctrl-B and
+// Ctrl-F move, Home and End or Ctrl-A and Ctrl-E jump to the ends,
+// Backspace and Delete erase, Ctrl-K and Ctrl-U kill to the end or the
+// start, up and down arrows or Ctrl-P and Ctrl-N recall history, Ctrl-C
+// abandons the line, and Ctrl-D at the start of an empty line ends input.
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	raw     func() (restore func(), err error) // puts the terminal in raw mode
+	history []string                           // earlier lines, oldest first
+	pending []byte                             // the rest of the line for Read
+
+	// state of the line being edited
+	line []rune
+	pos  int // cursor position in line
+}
+
+// newEditor returns an editor that starts with the lines of history
+func newEditor(in io.Reader, out io.Writer, raw func() (func(), error), history []string) *editor {
+	return &editor{in: bufio.NewReader(in), out: out, raw: raw, history: history}
+}
+
+// Read implements the io.Reader interface
+func (e *editor) Read(p []byte) (int, error) {
+	if len(e.pending) == 0 {
+		line, err := e.readLine()
+		if err != nil {
+			return 0, err
+		}
+		e.pending = []byte(line + "\n")
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+// readLine returns the next line that the user enters
+func (e *editor) readLine() (string, error) {
+	restore, err := e.raw()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	e.line, e.pos = nil, 0
+	// recall is the index of the history line being shown.
+	// saved is the line being entered before recall started.
+	recall, saved := len(e.history), ""
+	show := func(i int) {
+		e.edit(func() {
+			if i == len(e.history) {
+				e.line = []rune(saved)
+			} else {
+				e.line = []rune(e.history[i])
+			}
+			e.pos = len(e.line)
+		})
+		recall = i
+	}
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case "\r", "\n":
+			fmt.Fprint(e.out, "\r\n")
+			line := string(e.line)
+			if strings.TrimSpace(line) != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != line) {
+				e.history = append(e.history, line)
+			}
+			return line, nil
+		case "\x03": // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", nil
+		case "\x04": // Ctrl-D
+			if len(e.line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.edit(func() { e.delete(e.pos, e.pos+1) })
+		case "\x01", "\x1b[H", "\x1bOH", "\x1b[1~": // Ctrl-A, Home
+			e.move(0)
+		case "\x05", "\x1b[F", "\x1bOF", "\x1b[4~": // Ctrl-E, End
+			e.move(len(e.line))
+		case "\x02", "\x1b[D", "\x1bOD": // Ctrl-B, left
+			e.move(e.pos - 1)
+		case "\x06", "\x1b[C", "\x1bOC": // Ctrl-F, right
+			e.move(e.pos + 1)
+		case "\x7f", "\x08": // Backspace
+			if e.pos > 0 {
+				e.edit(func() { e.delete(e.pos-1, e.pos) })
+			}
+		case "\x1b[3~": // Delete
+			e.edit(func() { e.delete(e.pos, e.pos+1) })
+		case "\x0b": // Ctrl-K
+			e.edit(func() { e.delete(e.pos, len(e.line)) })
+		case "\x15": // Ctrl-U
+			e.edit(func() { e.delete(0, e.pos) })
+		case "\x10", "\x1b[A", "\x1bOA": // Ctrl-P, up
+			if recall > 0 {
+				if recall == len(e.history) {
+					saved = string(e.line)
+				}
+				show(recall - 1)
+			}
+		case "\x0e", "\x1b[B", "\x1bOB": // Ctrl-N, down
+			if recall < len(e.history) {
+				show(recall + 1)
+			}
+		default:
+			if r, _ := utf8.DecodeRuneInString(key); len(key) != utf8.RuneLen(r) || r < ' ' {
+				// ignore control characters and unknown escape sequences
+			} else if e.pos == len(e.line) {
+				// typing at the end of the line doesn't need a redraw
+				e.line, e.pos = append(e.line, r), e.pos+1
+				fmt.Fprint(e.out, key)
+			} else {
+				e.edit(func() {
+					e.line = append(e.line[:e.pos], append([]rune{r}, e.line[e.pos:]...)...)
+					e.pos++
+				})
+			}
+		}
+	}
+}
+
+// readKey returns the bytes for the next key. A key is a rune or an
+// escape sequence like the "\x1b[A" that the up arrow sends.
+func (e *editor) readKey() (string, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return "", err
+	} else if r != '\x1b' {
+		return string(r), nil
+	}
+	// ESC [ or ESC O, then parameters, then a final letter or ~
+	seq := []byte{'\x1b'}
+	for len(seq) < 8 {
+		b, err := e.in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		seq = append(seq, b)
+		if len(seq) == 2 && b != '[' && b != 'O' {
+			break
+		} else if len(seq) > 2 && (b == '~' || ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z')) {
+			break
+		}
+	}
+	return string(seq), nil
+}
+
+// delete removes the runes from i up to j, and moves the cursor to i
+func (e *editor) delete(i, j int) {
+	if i < 0 || j > len(e.line) || i >= j {
+		return
+	}
+	e.line, e.pos = append(e.line[:i], e.line[j:]...), i
+}
+
+// move puts the cursor at pos, which is clipped to the line
+func (e *editor) move(pos int) {
+	if pos < 0 {
+		pos = 0
+	} else if pos > len(e.line) {
+		pos = len(e.line)
+	}
+	if pos < e.pos {
+		fmt.Fprintf(e.out, "\x1b[%dD", e.pos-pos)
+	} else if pos > e.pos {
+		fmt.Fprintf(e.out, "\x1b[%dC", pos-e.pos)
+	}
+	e.pos = pos
+}
+
+// edit moves to the start of the line, applies the change, and
+// redraws the line, clearing whatever was displayed after it.
+// The terminal is assumed to show one column for each rune.
+func (e *editor) edit(change func()) {
+	if e.pos > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", e.pos)
+	}
+	change()
+	fmt.Fprintf(e.out, "%s\x1b[K", string(e.line))
+	if n := len(e.line) - e.pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
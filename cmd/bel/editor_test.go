@@ -0,0 +1,75 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestEditor(t *testing.T) {
+	raw := func() (func(), error) { return func() {}, nil }
+	for _, tc := range []struct {
+		name    string
+		keys    string
+		history []string
+		expect  string
+	}{
+		{"plain", "abc\r", nil, "abc"},
+		{"insert", "ab\x1b[Dx\r", nil, "axb"},
+		{"backspace", "abc\x7f\x7f\r", nil, "a"},
+		{"delete", "abc\x01\x1b[3~\r", nil, "bc"},
+		{"kill to end", "abc\x02\x02\x0b\r", nil, "a"},
+		{"kill to start", "abc\x02\x15\r", nil, "c"},
+		{"home and end", "bc\x01a\x05d\r", nil, "abcd"},
+		{"utf-8", "\\é\r", nil, `\é`},
+		{"recall", "\x1b[A\x1b[A\r", []string{"one", "two"}, "one"},
+		{"recall and return", "\x1b[A\x1b[A\x1b[B\r", []string{"one", "two"}, "two"},
+		{"recall and edit", "\x10 2\r", []string{"one", "two"}, "two 2"},
+		{"recall keeps the new line", "new\x1b[A\x1b[B\r", []string{"one"}, "new"},
+		{"interrupt", "abc\x03", nil, ""},
+	} {
+		e := newEditor(strings.NewReader(tc.keys), ioutil.Discard, raw, tc.history)
+		if got, err := e.readLine(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		} else if got != tc.expect {
+			t.Errorf("%s: expected %q: got %q", tc.name, tc.expect, got)
+		}
+	}
+
+	// lines are added to the history and Ctrl-D on an empty line ends input
+	e := newEditor(strings.NewReader("(+ 1\r2)\r\r\x1b[A\x1b[A\r\x04"), ioutil.Discard, raw, nil)
+	b, err := ioutil.ReadAll(e)
+	if err != nil {
+		t.Fatal(err)
+	} else if got := string(b); got != "(+ 1\n2)\n\n(+ 1\n" {
+		t.Errorf("read: expected %q: got %q", "(+ 1\n2)\n\n(+ 1\n", got)
+	}
+	if _, err := e.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read after Ctrl-D: expected EOF: got %v", err)
+	}
+}
@@ -27,19 +27,94 @@ package main
 //go:generate stringer -type opcode bel/opcode.go
 
 import (
+	"errors"
 	"fmt"
 	"github.com/mdhender/bel"
+	"io"
 	"os"
 )
 
+// stdout and stderr are where the commands write.
+// Tests replace them to capture the output.
+var stdout, stderr io.Writer = os.Stdout, os.Stderr
+
+var (
+	// errUsage means that the command line was not valid.
+	// The usage has already been reported.
+	errUsage = errors.New("usage")
+	// errFailed means that the Bel program signalled an error that it
+	// did not handle. The error has already been reported.
+	errFailed = errors.New("failed")
+)
+
+// commands are the subcommands, by name
+var commands = map[string]func(args []string) error{
+	"check": check,
+	"eval":  eval,
+	"run":   run,
+	"serve": serve,
+}
+
+func usage() {
+	fmt.Fprintln(stderr, `usage: bel [command [arguments]]
+
+With no command, bel starts an interactive session.
+
+commands:
+  run file.bel [args]            load a file, with *argv* bound to args
+  eval '(expr)' [args]           print the value of an expression
+  check file.bel ...             read files without evaluating them
+  serve [--port n] [--root dir]  run the application server
+  version                        print the version
+
+run and eval accept --no-prelude to skip loading the prelude and
+--trace text or --trace json to trace evaluation to stderr.`)
+}
+
+// main runs the command and exits with the code for its error
 func main() {
-	fmt.Println(bel.Version())
-	if bel.Version() == "" {
-		if err := run(); err != nil {
+	if len(os.Args) == 1 {
+		// with no arguments, start an interactive session
+		fmt.Printf("bel %s\n", bel.Version())
+		if err := repl(); err != nil {
 			fmt.Printf("%+v\n", err)
 			os.Exit(2)
 		}
+		return
+	}
+
+	name, args := os.Args[1], os.Args[2:]
+	if name == "version" {
+		fmt.Println(bel.Version())
+		return
+	} else if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
 	}
+	if code := command(name, args); code != 0 {
+		os.Exit(code)
+	}
+}
 
-	fmt.Println("thank you")
+// command runs the command and returns 0 if it succeeded, 1 if the
+// Bel program signalled an error that it did not handle, and 2 for
+// any other error.
+func command(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "bel: unknown command %q\n", name)
+		usage()
+		return 2
+	}
+	switch err := cmd(args); err {
+	case nil:
+		return 0
+	case errFailed:
+		return 1
+	case errUsage:
+		return 2
+	default:
+		fmt.Fprintf(stderr, "bel: %v\n", err)
+		return 2
+	}
 }
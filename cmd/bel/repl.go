@@ -0,0 +1,106 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bufio"
+	"github.com/mdhender/bel/bel"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+)
+
+// historySize is the number of lines of history that are recalled
+const historySize = 1000
+
+// repl runs an interactive session on the console.
+// Input is saved to $HOME/.bel_history, or to the file named by
+// $BEL_HISTORY if it is set, and the lines saved by earlier sessions
+// can be recalled and edited. Ctrl-C interrupts the expression being
+// evaluated and Ctrl-D ends the session.
+func repl() error {
+	vm := bel.NewVM(nil)
+
+	name := os.Getenv("BEL_HISTORY")
+	if name == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			name = filepath.Join(home, ".bel_history")
+		}
+	}
+	var lines []string
+	var history *os.File
+	if name != "" {
+		var err error
+		if lines, err = readHistory(name); err != nil && !os.IsNotExist(err) {
+			log.Printf("[repl] history: %v\n", err)
+		}
+		if history, err = os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+			log.Printf("[repl] history: %v\n", err)
+		} else {
+			defer history.Close()
+		}
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			vm.Interrupt()
+		}
+	}()
+
+	// lines are edited only on a terminal
+	var in io.Reader = os.Stdin
+	if isTerminal(os.Stdin.Fd()) {
+		in = newEditor(os.Stdin, os.Stdout, rawMode(os.Stdin.Fd()), lines)
+	}
+	if history == nil {
+		return vm.Interact(in, nil)
+	}
+	return vm.Interact(in, history)
+}
+
+// readHistory returns the last lines of the history file
+func readHistory(name string) ([]string, error) {
+	fp, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	var lines []string
+	s := bufio.NewScanner(fp)
+	for s.Scan() {
+		if lines = append(lines, s.Text()); len(lines) > 2*historySize {
+			lines = append(lines[:0], lines[len(lines)-historySize:]...)
+		}
+	}
+	if len(lines) > historySize {
+		lines = lines[len(lines)-historySize:]
+	}
+	return lines, s.Err()
+}
@@ -25,54 +25,134 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"github.com/mdhender/bel/app"
 	"github.com/mdhender/bel/bel"
-	"io/ioutil"
-	"log"
 	"os"
 )
 
-func run() error {
-	config := struct {
-		root   string
-		port   int
-		public string
-	}{
-		root:   ".",
-		port:   3001,
-		public: "public",
+// vmConfig holds the flags for creating a VM
+type vmConfig struct {
+	noPrelude bool
+	trace     string
+}
+
+// vmFlags adds the flags for creating a VM to a flag set
+func vmFlags(fs *flag.FlagSet) *vmConfig {
+	c := &vmConfig{}
+	fs.BoolVar(&c.noPrelude, "no-prelude", false, "do not load the prelude")
+	fs.StringVar(&c.trace, "trace", "", "trace evaluation to stderr as `text` or json")
+	return c
+}
+
+// newVM returns a VM with *argv* bound to the arguments.
+// Loading the prelude is not traced.
+func (c *vmConfig) newVM(argv []string) (*bel.VM, error) {
+	var tracer bel.Tracer
+	switch c.trace {
+	case "":
+	case "text":
+		tracer = bel.NewTextTracer(stderr)
+	case "json":
+		tracer = bel.NewJSONTracer(stderr)
+	default:
+		fmt.Fprintf(stderr, "bel: unknown trace format %q\n", c.trace)
+		return nil, errUsage
+	}
+	opts := []bel.Option{bel.WithArgv(argv), bel.WithIO(os.Stdin, stdout, stderr)}
+	if c.noPrelude {
+		opts = append(opts, bel.WithoutPrelude())
+	}
+	vm := bel.NewVM(nil, opts...)
+	if tracer != nil {
+		vm.SetTracer(tracer)
 	}
+	return vm, nil
+}
 
-	var err error
-	if config.root == "" {
-		if config.root, err = os.Getwd(); err != nil {
-			return err
-		}
-	} else if err = os.Chdir(config.root); err != nil {
+// run loads a file of Bel code. The arguments after the file name
+// are bound to *argv* as a list of strings.
+// usage: bel run [--no-prelude] [--trace format] file.bel [args]
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	config := vmFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	} else if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: bel run [--no-prelude] [--trace format] file.bel [args]")
+		return errUsage
+	}
+	name := fs.Arg(0)
+	if _, err := os.Stat(name); err != nil {
 		return err
 	}
-	log.Printf("[app] root %q\n", config.root)
 
-	src, err := ioutil.ReadFile("source.bel")
+	vm, err := config.newVM(fs.Args()[1:])
 	if err != nil {
 		return err
 	}
+	if err := vm.Load(name); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return errFailed
+	}
+	return nil
+}
 
-	vm := bel.NewVM([]string{"source.bel"})
-	if vm == nil {
-		panic("missing vm")
+// eval evaluates the expressions in its argument and prints the
+// value of the last one.
+// usage: bel eval [--no-prelude] [--trace format] '(expr)' [args]
+func eval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	config := vmFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	} else if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: bel eval [--no-prelude] [--trace format] '(expr)' [args]")
+		return errUsage
 	}
-	c, err := vm.Execute(src)
-	fmt.Printf("[app] result %d\n", len(c))
+
+	vm, err := config.newVM(fs.Args()[1:])
 	if err != nil {
 		return err
 	}
-	fmt.Println(c)
-	if c != nil {
-		return nil
+	values, err := vm.Execute([]byte(fs.Arg(0)))
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return errFailed
+	} else if len(values) != 0 {
+		fmt.Fprintln(stdout, values[len(values)-1])
+	}
+	return nil
+}
+
+// check reads each file without evaluating it and reports the first
+// syntax error in each.
+// usage: bel check file.bel ...
+func check(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	} else if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: bel check file.bel ...")
+		return errUsage
 	}
 
-	a := app.NewServer(config.port)
-	return a.ListenAndServe()
+	vm := bel.NewVM(nil, bel.WithoutPrelude(), bel.WithIO(os.Stdin, stdout, stderr))
+	var failed error
+	for _, name := range fs.Args() {
+		fp, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = vm.Check(name, fp)
+		fp.Close()
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			failed = errFailed
+		}
+	}
+	return failed
 }
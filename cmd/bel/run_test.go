@@ -0,0 +1,97 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, text := range map[string]string{
+		"hello.bel": "(prn 'hello (car *argv*))\n",
+		"bad.bel":   "(car 'a)\n",
+		"a.bel":     `(load "` + filepath.Join(dir, "b.bel") + `")` + "\n",
+		"b.bel":     `(load "` + filepath.Join(dir, "a.bel") + `")` + "\n",
+		"open.bel":  "(a b\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	defer func() { stdout, stderr = os.Stdout, os.Stderr }()
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string // expected output
+		stderr string // expected in the errors
+	}{
+		{"run", []string{"run", file("hello.bel"), "world"}, 0, "hello \"world\" \n", ""},
+		{"run error", []string{"run", file("bad.bel")}, 1, "", "car-on-atom"},
+		{"run load cycle", []string{"run", file("a.bel")}, 1, "", "load-cycle"},
+		{"run missing file", []string{"run", file("missing.bel")}, 2, "", "missing.bel"},
+		{"run without file", []string{"run"}, 2, "", "usage: bel run"},
+		{"run bad flag", []string{"run", "--bad", file("hello.bel")}, 2, "", "not defined: -bad"},
+		{"run bad trace", []string{"run", "--trace", "xml", file("hello.bel")}, 2, "", "unknown trace format"},
+		{"eval", []string{"eval", "(+ 1 2)"}, 0, "3\n", ""},
+		{"eval last value", []string{"eval", "(set x 2) (* x x)"}, 0, "4\n", ""},
+		{"eval argv", []string{"eval", "*argv*", "a", "b"}, 0, "(\"a\" \"b\")\n", ""},
+		{"eval without prelude", []string{"eval", "--no-prelude", "(no nil)"}, 1, "", "no"},
+		{"eval error", []string{"eval", "(car 'a)"}, 1, "", "car-on-atom"},
+		{"eval unterminated", []string{"eval", "(+ 1"}, 1, "", "unterminated"},
+		{"eval without expression", []string{"eval"}, 2, "", "usage: bel eval"},
+		{"check", []string{"check", file("hello.bel"), file("bad.bel")}, 0, "", ""},
+		{"check unterminated", []string{"check", file("hello.bel"), file("open.bel")}, 1, "", "open.bel"},
+		{"check missing file", []string{"check", file("missing.bel")}, 2, "", "missing.bel"},
+		{"check without file", []string{"check"}, 2, "", "usage: bel check"},
+		{"unknown command", []string{"frob"}, 2, "", `unknown command "frob"`},
+	} {
+		out, errs := &bytes.Buffer{}, &bytes.Buffer{}
+		stdout, stderr = out, errs
+		if code := command(tc.args[0], tc.args[1:]); code != tc.code {
+			t.Errorf("%s: expected exit %d: got %d: %s", tc.name, tc.code, code, errs.String())
+		}
+		if got := out.String(); got != tc.stdout {
+			t.Errorf("%s: expected %q: got %q", tc.name, tc.stdout, got)
+		}
+		if got := errs.String(); tc.stderr == "" && got != "" {
+			t.Errorf("%s: expected no errors: got %q", tc.name, got)
+		} else if !strings.Contains(got, tc.stderr) {
+			t.Errorf("%s: expected %q: got %q", tc.name, tc.stderr, got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Bel - an implementation of Paul Graham's Bel
+ *
+ * Copyright (c) 2021 Michael D Henderson
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package main
+
+import (
+	"flag"
+	"github.com/mdhender/bel/app"
+	"log"
+	"os"
+)
+
+// serve runs the application server.
+// usage: bel serve [--port n] [--root dir]
+func serve(args []string) error {
+	config := struct {
+		root string
+		port int
+	}{}
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.IntVar(&config.port, "port", 3001, "port to listen on")
+	fs.StringVar(&config.root, "root", ".", "directory to serve from")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	} else if fs.NArg() != 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	var err error
+	if config.root == "" {
+		if config.root, err = os.Getwd(); err != nil {
+			return err
+		}
+	} else if err = os.Chdir(config.root); err != nil {
+		return err
+	}
+	log.Printf("[app] root %q\n", config.root)
+
+	a := app.NewServer(config.port)
+	return a.ListenAndServe()
+}